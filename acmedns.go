@@ -6,6 +6,7 @@ package acmedns
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 
@@ -24,35 +25,160 @@ const (
 // DNS can create, update, and remove TXT records on name servers.  It doesn't
 // have to be instantaneous.
 type DNS interface {
-	// ModifyTXTRecord creates, updates, or removes a TXT record.  It blocks
-	// until the modification is complete or the context is done.
-	ModifyTXTRecord(ctx context.Context, zone, node string, values []string, ttl uint32) error
+	// AppendTXTValue adds value to the TXT RRset at node in zone, without
+	// disturbing any other values already there.  It blocks until the
+	// modification is complete or the context is done.  This must not
+	// clobber a sibling authorization's still-pending challenge value: a
+	// certificate covering both a zone's apex and its wildcard name gets
+	// two concurrent dns-01 authorizations, both published at the same
+	// _acme-challenge node.
+	AppendTXTValue(ctx context.Context, zone, node, value string, ttl uint32) error
+
+	// RemoveTXTValue removes a single value from the TXT RRset at node at
+	// some point in the future, leaving any other values in place.  It
+	// doesn't wait for the modification to be complete, and it's ok if the
+	// value isn't there.
+	RemoveTXTValue(zone, node, value string) error
+}
 
-	// ForgetTXTRecord removes a TXT record at some point in the future.  It
-	// doesn't wait for the modification to be complete.
-	ForgetTXTRecord(zone, node string) error
+// PropagationChecker verifies that a dns-01 challenge value is actually
+// visible on a zone's authoritative name servers before Verify hands the
+// challenge to client.Accept.  This matters whenever whatever answers for
+// the zone isn't just this process's own in-memory state: secondary/slave
+// NS mirrors, a load-balanced anycast pair, or an off-box DNS provider all
+// have their own propagation delay that a bare one-second sleep can't be
+// relied on to cover.
+//
+// dns/dnsprop.Config is the default implementation, resolving the zone's NS
+// set via net.LookupNS and querying each one directly.  Implement this
+// interface instead to use a custom resolver list, e.g. for split-horizon
+// or hidden-primary setups where the public NS set doesn't include every
+// server that matters.
+type PropagationChecker interface {
+	Check(ctx context.Context, zone, fqdn, value string) error
 }
 
-func Verify(ctx context.Context, client *acme.Client, dns DNS, serverName, zone string) (err error) {
-	authz, err := client.Authorize(ctx, serverName)
-	if err != nil {
-		return
+// EAB authenticates first-time ACME account registration via External
+// Account Binding (RFC 8555 §7.3.4).  CAs that don't accept anonymous
+// account creation -- ZeroSSL's and Google Trust Services' ACME endpoints,
+// or an internal CA -- hand these out alongside (or instead of) an API
+// key, out of band from the ACME protocol itself.
+type EAB struct {
+	// KeyID identifies the account with the CA.
+	KeyID string
+
+	// HMACKey is the base64url-encoded (unpadded) MAC key the CA gave out
+	// alongside KeyID, used to sign the registration request per RFC 8555
+	// §7.3.4.
+	HMACKey string
+}
+
+// Register creates an ACME account on client, binding it via eab if eab is
+// non-nil.  Callers driving Verify/VerifyAll directly (rather than through
+// autocert.Manager, which registers its own Issuers) against a CA that
+// requires EAB must call this once before the first Verify; without eab
+// it's equivalent to calling client.Register directly, for CAs that accept
+// anonymous registration.
+func Register(ctx context.Context, client *acme.Client, eab *EAB, prompt func(tosURL string) bool) (*acme.Account, error) {
+	acct := &acme.Account{}
+
+	if eab != nil {
+		hmacKey, err := base64.RawURLEncoding.DecodeString(eab.HMACKey)
+		if err != nil {
+			return nil, fmt.Errorf("acmedns: decode EAB HMAC key: %w", err)
+		}
+		acct.ExternalAccountBinding = &acme.ExternalAccountBinding{KID: eab.KeyID, Key: hmacKey}
 	}
 
-	switch authz.Status {
-	case acme.StatusValid:
-		// ok
+	return client.Register(ctx, acct, prompt)
+}
+
+// Verify obtains and fulfills an ACME dns-01 authorization for serverName in
+// zone.  If prop is non-nil, the challenge record is not handed off to
+// client.Accept until it has propagated according to prop.
+func Verify(ctx context.Context, client *acme.Client, dns DNS, serverName, zone string, prop PropagationChecker) error {
+	return VerifyAll(ctx, client, dns, []string{serverName}, zone, prop)
+}
+
+// VerifyAll obtains and fulfills ACME dns-01 authorizations for every name in
+// serverNames, all belonging to the same zone and the same certificate
+// request (e.g. a zone's apex and its wildcard name).  Every name's
+// challenge TXT value is published before any of them is handed off to
+// client.Accept: the authorizations are otherwise independent, and the CA
+// may start checking one as soon as it's accepted, which would race another
+// still-pending authorization's AppendTXTValue call.
+func VerifyAll(ctx context.Context, client *acme.Client, dns DNS, serverNames []string, zone string, prop PropagationChecker) error {
+	var pending []*acquisition
+
+	// completed holds only the acquisitions whose Accept and
+	// WaitAuthorization have both finished.  An authorization that's been
+	// accepted but not yet waited on is still in flight at the CA; its TXT
+	// value must stay published (even if a sibling authorization's Accept
+	// or WaitAuthorization fails and VerifyAll returns early) or the CA's
+	// validation of it can fail for DNS reasons that have nothing to do
+	// with the actual failure.
+	var completed []*acquisition
+
+	defer func() {
+		for _, a := range completed {
+			dns.RemoveTXTValue(zone, challengeNode, a.value)
+		}
+	}()
+
+	for _, serverName := range serverNames {
+		authz, err := client.Authorize(ctx, serverName)
+		if err != nil {
+			return err
+		}
 
-	case acme.StatusInvalid:
-		err = fmt.Errorf("acmedns: invalid authorization %q", authz.URI)
+		switch authz.Status {
+		case acme.StatusValid:
+			continue // already satisfied; nothing to present or accept
+
+		case acme.StatusInvalid:
+			return fmt.Errorf("acmedns: invalid authorization %q", authz.URI)
+		}
 
-	default:
-		_, err = acquireAuthorization(ctx, client, authz, dns, zone)
+		a, err := acquireAuthorization(ctx, client, authz, dns, zone)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, a)
 	}
-	return
+
+	if prop != nil {
+		for _, a := range pending {
+			if err := prop.Check(ctx, zone, challengeNode+"."+zone, a.value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, a := range pending {
+		if _, err := client.Accept(ctx, a.challenge); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range pending {
+		if _, err := client.WaitAuthorization(ctx, a.authz.URI); err != nil {
+			return err
+		}
+		completed = append(completed, a)
+	}
+
+	return nil
 }
 
-func acquireAuthorization(ctx context.Context, client *acme.Client, authz *acme.Authorization, dns DNS, zone string) (*acme.Authorization, error) {
+// acquisition is a dns-01 challenge whose value has been published but not
+// yet accepted.
+type acquisition struct {
+	authz     *acme.Authorization
+	challenge *acme.Challenge
+	value     string
+}
+
+func acquireAuthorization(ctx context.Context, client *acme.Client, authz *acme.Authorization, dns DNS, zone string) (*acquisition, error) {
 	combos := authz.Combinations
 	if len(combos) == 0 {
 		combo := make([]int, len(authz.Challenges))
@@ -62,46 +188,45 @@ func acquireAuthorization(ctx context.Context, client *acme.Client, authz *acme.
 		combos = [][]int{combo}
 	}
 
-	var (
-		accepted *acme.Challenge
-		err      error
-	)
+	var err error
 
 	for _, combo := range combos {
-		if len(combo) == 1 {
-			if i := combo[0]; i < len(authz.Challenges) {
-				chal := authz.Challenges[i]
-				err = fulfillChallenge(ctx, client, chal, dns, zone)
-				if err == nil {
-					defer dns.ForgetTXTRecord(zone, challengeNode) // After WaitAuthorization
-					accepted, err = client.Accept(ctx, chal)
-					if err == nil {
-						break
-					}
-				}
-			}
+		if len(combo) != 1 {
+			continue
+		}
+
+		i := combo[0]
+		if i >= len(authz.Challenges) {
+			continue
 		}
-	}
 
-	if accepted == nil {
+		chal := authz.Challenges[i]
+		var value string
+		value, err = fulfillChallenge(ctx, client, chal, dns, zone)
 		if err == nil {
-			err = errors.New("acmedns: no supported challenge combinations")
+			return &acquisition{authz: authz, challenge: chal, value: value}, nil
 		}
-		return nil, err
 	}
 
-	return client.WaitAuthorization(ctx, authz.URI)
+	if err == nil {
+		err = errors.New("acmedns: no supported challenge combinations")
+	}
+	return nil, err
 }
 
-func fulfillChallenge(ctx context.Context, client *acme.Client, chal *acme.Challenge, dns DNS, zone string) error {
+func fulfillChallenge(ctx context.Context, client *acme.Client, chal *acme.Challenge, dns DNS, zone string) (value string, err error) {
 	if chal.Type != challengeType {
-		return errors.New("acmedns: unsupported challenge types")
+		return "", errors.New("acmedns: unsupported challenge types")
 	}
 
-	value, err := client.DNS01ChallengeRecord(chal.Token)
+	value, err = client.DNS01ChallengeRecord(chal.Token)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	if err = dns.AppendTXTValue(ctx, zone, challengeNode, value, challengeTTL); err != nil {
+		return "", err
 	}
 
-	return dns.ModifyTXTRecord(ctx, zone, challengeNode, []string{value}, challengeTTL)
+	return value, nil
 }
@@ -0,0 +1,111 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	acmeautocert "golang.org/x/crypto/acme/autocert"
+)
+
+// DistributedCache extends autocert.Cache with cross-process locking, so
+// that only one node in a cluster performs the ACME dance for a given name
+// at a time; the rest block on Lock and then find the certificate already
+// sitting in the cache once they get it.
+type DistributedCache interface {
+	acmeautocert.Cache
+
+	// Lock acquires an exclusive lock for key, blocking until it is
+	// acquired or ctx is done.  The returned unlock function releases it.
+	Lock(ctx context.Context, key string) (unlock func() error, err error)
+}
+
+// defaultStaleAfter is FileLockCache's default StaleAfter.
+const defaultStaleAfter = 10 * time.Minute
+
+// FileLockCache is a DistributedCache backed by the local filesystem: cache
+// entries are stored the same way as acmeautocert.DirCache, and locking uses
+// O_EXCL lock files rather than flock(2), so it works on any filesystem that
+// honors exclusive creation (including most network filesystems) without a
+// cgo dependency.  For backends without a shared filesystem, implement
+// DistributedCache directly against Redis, etcd, or S3 conditional writes.
+type FileLockCache struct {
+	acmeautocert.DirCache
+
+	// LockTimeout bounds how long Lock waits to acquire the lock before
+	// giving up.  Defaults to 1 minute.
+	LockTimeout time.Duration
+
+	// LockPollInterval is how often a blocked Lock call retries.  Defaults
+	// to 200ms.
+	LockPollInterval time.Duration
+
+	// StaleAfter is how old a lock file is allowed to get before Lock
+	// assumes its holder died without releasing it and removes the lock
+	// file itself instead of waiting out the full LockTimeout.  Defaults to
+	// 10 minutes, which comfortably outlasts a single ACME order.
+	StaleAfter time.Duration
+}
+
+// NewFileLockCache creates a FileLockCache rooted at dir, which is created
+// with 0700 permissions if it doesn't exist, mirroring acmeautocert.DirCache.
+func NewFileLockCache(dir string) *FileLockCache {
+	return &FileLockCache{DirCache: acmeautocert.DirCache(dir)}
+}
+
+func (c *FileLockCache) Lock(ctx context.Context, key string) (unlock func() error, err error) {
+	path := filepath.Join(string(c.DirCache), key+".lock")
+
+	if err := os.MkdirAll(string(c.DirCache), 0700); err != nil {
+		return nil, err
+	}
+
+	timeout := c.LockTimeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	interval := c.LockPollInterval
+	if interval == 0 {
+		interval = 200 * time.Millisecond
+	}
+	staleAfter := c.StaleAfter
+	if staleAfter == 0 {
+		staleAfter = defaultStaleAfter
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() error { return os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("autocert: create lock file %s: %w", path, err)
+		}
+
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > staleAfter {
+			// Its holder almost certainly crashed or was killed without
+			// running its unlock func, or this lock file would have been
+			// removed long ago; break it rather than wait out LockTimeout
+			// forever on every future caller.  Best effort: if another
+			// node wins the create race first, the next loop iteration
+			// just blocks on its lock instead.
+			os.Remove(path)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("autocert: lock %q: %w", key, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	acmeautocert "golang.org/x/crypto/acme/autocert"
+)
+
+func TestFileLockCacheLockUnlock(t *testing.T) {
+	c := NewFileLockCache(t.TempDir())
+
+	unlock, err := c.Lock(context.Background(), "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second Lock after unlock must succeed immediately.
+	unlock2, err := c.Lock(context.Background(), "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock2()
+}
+
+func TestFileLockCacheBlocksUntilUnlocked(t *testing.T) {
+	c := &FileLockCache{
+		DirCache:         acmeautocert.DirCache(t.TempDir()),
+		LockPollInterval: 10 * time.Millisecond,
+		LockTimeout:      time.Second,
+	}
+
+	unlock, err := c.Lock(context.Background(), "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock2, err := c.Lock(context.Background(), "example.org")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		unlock2()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second Lock returned before the first was released")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second Lock never acquired after the first was released")
+	}
+}
+
+func TestFileLockCacheBreaksStaleLock(t *testing.T) {
+	dir := acmeautocert.DirCache(t.TempDir())
+	c := &FileLockCache{
+		DirCache:         dir,
+		LockPollInterval: 10 * time.Millisecond,
+		LockTimeout:      time.Second,
+		StaleAfter:       50 * time.Millisecond,
+	}
+
+	// Simulate a holder that created the lock file and then crashed
+	// without ever calling unlock: back-date its mtime past StaleAfter.
+	path := filepath.Join(string(dir), "example.org.lock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	unlock, err := c.Lock(context.Background(), "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	if elapsed := time.Since(start); elapsed >= c.LockTimeout {
+		t.Fatalf("Lock took %v, as if it waited out LockTimeout instead of breaking the stale lock", elapsed)
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+// EABCredentials authenticates first-time ACME account registration via
+// External Account Binding (RFC 8555 §7.3.4).  CAs that don't accept
+// anonymous account creation -- ZeroSSL's and Google Trust Services' ACME
+// endpoints, or an internal CA -- hand these out alongside (or instead of)
+// an API key, out of band from the ACME protocol itself.
+type EABCredentials struct {
+	// KeyID identifies the account with the CA.
+	KeyID string
+
+	// HMACKey is the base64url-encoded (unpadded) MAC key the CA gave out
+	// alongside KeyID, used to sign the registration request per RFC 8555
+	// §7.3.4.
+	HMACKey string
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"time"
+)
+
+// EventType identifies a point in a certificate's lifecycle.
+type EventType string
+
+const (
+	CertObtaining          EventType = "CertObtaining"
+	CertObtainFailed       EventType = "CertObtainFailed"
+	CertObtained           EventType = "CertObtained"
+	CertCached             EventType = "CertCached"
+	DNSChallengePresenting EventType = "DNSChallengePresenting"
+	DNSChallengeCleaned    EventType = "DNSChallengeCleaned"
+)
+
+// Event describes an occurrence in a certificate's lifecycle.  Hostname is
+// the SNI name involved (which may be a wildcard name, see WildcardCacheKey).
+// Issuer and Expiry are set when known; Err is set for the *Failed types.
+type Event struct {
+	Type     EventType
+	Hostname string
+	Issuer   string
+	Expiry   time.Time
+	Err      error
+	Data     map[string]interface{}
+}
+
+// EventHandler is called synchronously for each lifecycle event, with a
+// context bound to the operation that triggered it.  A handler may block
+// (e.g. to push the new certificate to a sibling node or a load balancer)
+// before the call that triggered the event returns its result.
+type EventHandler func(ctx context.Context, event Event)
+
+func (m *Manager) notify(ctx context.Context, event Event) {
+	if m.Events != nil {
+		m.Events(ctx, event)
+	}
+}
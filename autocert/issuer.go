@@ -0,0 +1,439 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/tsavola/acmedns"
+)
+
+// Issuer obtains a TLS certificate for a certificate signing request, via
+// whatever protocol and CA it wants.  It lets Manager fall back from one CA
+// to another (e.g. Let's Encrypt to ZeroSSL) instead of being stuck with a
+// single hard-coded ACME directory.
+type Issuer interface {
+	// Name identifies the issuer, e.g. for log messages and per-issuer
+	// failure tracking ("letsencrypt", "zerossl").
+	Name() string
+
+	// Issue requests and waits for a certificate for csr, which already
+	// carries the public key and the single DNS SAN Manager wants a
+	// certificate for.  The returned Certificate.Certificate is the
+	// DER-encoded chain; Manager fills in Certificate.PrivateKey itself.
+	Issue(ctx context.Context, csr *x509.CertificateRequest) (*tls.Certificate, error)
+}
+
+// csrTweaker is implemented by Issuers that need to customize the
+// certificate signing request before it's signed, e.g. to set a
+// CommonName some CAs require.  issueCertificate checks for it so that
+// every issuer in Manager.Issuers gets its own CSR, tweaked to its own
+// taste, instead of forcing one shared CSR shape on all of them.
+type csrTweaker interface {
+	TweakCSR(*x509.CertificateRequest)
+}
+
+// ACMEIssuer is an Issuer backed by an ACME directory (Let's Encrypt,
+// Buypass, Google Trust Services, or any other ACME CA), which proves
+// control of each name through its Verify function.
+type ACMEIssuer struct {
+	Client *acme.Client
+
+	// Verify is called once per DNSNames entry in the CSR before the
+	// certificate is requested.  It must be set: Issue calls it
+	// unconditionally, and Manager does not fill it in.
+	Verify func(ctx context.Context, client *acme.Client, serverName string) error
+
+	// IssuerName overrides Name(); defaults to "acme".
+	IssuerName string
+
+	// Events, if set, receives DNSChallengePresenting/DNSChallengeCleaned
+	// notifications around each domain's verification.
+	Events EventHandler
+
+	// EAB, if set, authenticates this issuer's first-time ACME account
+	// registration via External Account Binding.  Required by CAs that
+	// don't accept anonymous account creation, e.g. ZeroSSL's and Google
+	// Trust Services' ACME endpoints.
+	EAB *EABCredentials
+
+	// Prompt is passed to Client.Register for EAB's TOS-acceptance
+	// argument. Defaults to acme.AcceptTOS.
+	Prompt func(tosURL string) bool
+
+	// CSRTweaks, if set, is called on the certificate signing request
+	// before it's signed, e.g. to set a CommonName for a CA that rejects
+	// CSRs without one.
+	CSRTweaks func(*x509.CertificateRequest)
+
+	registerMu sync.Mutex
+	registered bool
+}
+
+func (i *ACMEIssuer) Name() string {
+	if i.IssuerName != "" {
+		return i.IssuerName
+	}
+	return "acme"
+}
+
+// TweakCSR implements csrTweaker.
+func (i *ACMEIssuer) TweakCSR(csr *x509.CertificateRequest) {
+	if i.CSRTweaks != nil {
+		i.CSRTweaks(csr)
+	}
+}
+
+func (i *ACMEIssuer) Issue(ctx context.Context, csr *x509.CertificateRequest) (*tls.Certificate, error) {
+	if err := i.register(ctx); err != nil {
+		return nil, fmt.Errorf("autocert: %s: register account: %w", i.Name(), err)
+	}
+
+	for _, name := range csr.DNSNames {
+		i.notify(ctx, Event{Type: DNSChallengePresenting, Hostname: name, Issuer: i.Name()})
+		err := i.Verify(ctx, i.Client, name)
+		i.notify(ctx, Event{Type: DNSChallengeCleaned, Hostname: name, Issuer: i.Name(), Err: err})
+		if err != nil {
+			return nil, fmt.Errorf("autocert: %s: %w", name, err)
+		}
+	}
+
+	der, _, err := i.Client.CreateCert(ctx, csr.Raw, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{Certificate: der}, nil
+}
+
+func (i *ACMEIssuer) notify(ctx context.Context, event Event) {
+	if i.Events != nil {
+		i.Events(ctx, event)
+	}
+}
+
+// register creates an ACME account bound to i.EAB, if one hasn't been
+// registered yet on i.Client. It's a no-op when EAB isn't set: Client is
+// then assumed to already carry a registered account, as it did before EAB
+// support existed.
+//
+// registered is only ever set on a successful Register call, not on entry
+// to this method: a transient failure (network blip, CA momentarily down)
+// must not permanently poison every later Issue call for the lifetime of
+// the ACMEIssuer the way a sync.Once guard would.
+func (i *ACMEIssuer) register(ctx context.Context) error {
+	if i.EAB == nil {
+		return nil
+	}
+
+	i.registerMu.Lock()
+	defer i.registerMu.Unlock()
+
+	if i.registered {
+		return nil
+	}
+
+	prompt := i.Prompt
+	if prompt == nil {
+		prompt = acme.AcceptTOS
+	}
+
+	eab := acmedns.EAB{KeyID: i.EAB.KeyID, HMACKey: i.EAB.HMACKey}
+	if _, err := acmedns.Register(ctx, i.Client, &eab, prompt); err != nil {
+		return err
+	}
+
+	i.registered = true
+	return nil
+}
+
+func certExpiry(cert *tls.Certificate) time.Time {
+	if len(cert.Certificate) == 0 {
+		return time.Time{}
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return time.Time{}
+	}
+	return leaf.NotAfter
+}
+
+// defaultRenewBefore is used in place of Manager.RenewBefore when it's
+// unset, matching golang.org/x/crypto/acme/autocert's own default.
+const defaultRenewBefore = 30 * 24 * time.Hour
+
+// renewBefore returns m.RenewBefore, or defaultRenewBefore if it's unset.
+func (m *Manager) renewBefore() time.Duration {
+	if m.RenewBefore > 0 {
+		return m.RenewBefore
+	}
+	return defaultRenewBefore
+}
+
+// needsRenewal reports whether cert is unparseable or within renewBefore of
+// its expiry, and so shouldn't be served out of the cache as-is.
+func (m *Manager) needsRenewal(cert *tls.Certificate) bool {
+	expiry := certExpiry(cert)
+	if expiry.IsZero() {
+		return true
+	}
+	return time.Now().After(expiry.Add(-m.renewBefore()))
+}
+
+// issueCertificate tries m.Issuers in order (preferring, per
+// orderIssuersByFailureState, ones that aren't cached as having last
+// failed name), caching the first certificate obtained under name.  If
+// Cache is a DistributedCache, only one node performs the issuance for a
+// given name at a time; the rest block on Lock and then pick up what the
+// lock holder cached.
+func (m *Manager) issueCertificate(ctx context.Context, name string) (*tls.Certificate, error) {
+	if cert, err := m.loadCachedCertificate(ctx, name); err == nil {
+		return cert, nil
+	}
+
+	if dc, ok := m.Cache.(DistributedCache); ok {
+		unlock, err := dc.Lock(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("autocert: lock %q: %w", name, err)
+		}
+		defer unlock()
+
+		if cert, err := m.loadCachedCertificate(ctx, name); err == nil {
+			return cert, nil
+		}
+	}
+
+	m.notify(ctx, Event{Type: CertObtaining, Hostname: name})
+
+	var lastErr error
+	for _, issuer := range m.orderIssuersByFailureState(ctx, name) {
+		var tweak func(*x509.CertificateRequest)
+		if t, ok := issuer.(csrTweaker); ok {
+			tweak = t.TweakCSR
+		}
+
+		key, csr, err := newCSR(m.ForceRSA, name, tweak)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", issuer.Name(), err)
+			continue
+		}
+
+		cert, err := issuer.Issue(ctx, csr)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", issuer.Name(), err)
+			if m.DebugLog != nil {
+				m.DebugLog.Printf("autocert: %v", lastErr)
+			}
+			m.markIssuerFailed(ctx, name, issuer.Name())
+			continue
+		}
+
+		m.clearIssuerFailed(ctx, name, issuer.Name())
+
+		cert.PrivateKey = key
+
+		expiry := certExpiry(cert)
+		m.notify(ctx, Event{Type: CertObtained, Hostname: name, Issuer: issuer.Name(), Expiry: expiry})
+
+		if m.Cache != nil {
+			if err := m.storeCachedCertificate(ctx, name, cert); err != nil && m.DebugLog != nil {
+				m.DebugLog.Printf("autocert: cache %q: %v", name, err)
+			} else if err == nil {
+				m.notify(ctx, Event{Type: CertCached, Hostname: name, Issuer: issuer.Name(), Expiry: expiry})
+			}
+		}
+
+		return cert, nil
+	}
+
+	m.notify(ctx, Event{Type: CertObtainFailed, Hostname: name, Err: lastErr})
+
+	if lastErr == nil {
+		lastErr = errors.New("autocert: no issuers configured")
+	}
+	return nil, lastErr
+}
+
+// newCSR generates a key pair and a signed certificate signing request for
+// name. If tweak is non-nil, it's given a chance to alter the request
+// template (e.g. to set a CommonName some CAs require) before it's signed.
+func newCSR(forceRSA bool, name string, tweak func(*x509.CertificateRequest)) (key crypto.Signer, csr *x509.CertificateRequest, err error) {
+	if forceRSA {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.CertificateRequest{DNSNames: []string{name}}
+	if tweak != nil {
+		tweak(template)
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	csr, err = x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, csr, nil
+}
+
+// orderIssuersByFailureState returns m.Issuers with any issuer that's
+// cached as having last failed name moved to the end, in their original
+// relative order.  This lets the fallback decision survive restarts: a
+// node that just rebooted won't waste a renewal's worth of time hitting a
+// CA that every other node already knows is rate-limited or down for
+// name.  It doesn't drop a failed issuer entirely, so the CA gets retried
+// (and, on success, un-marked) once every currently-preferred issuer has
+// failed too.
+func (m *Manager) orderIssuersByFailureState(ctx context.Context, name string) []Issuer {
+	if m.Cache == nil || len(m.Issuers) < 2 {
+		return m.Issuers
+	}
+
+	ordered := make([]Issuer, 0, len(m.Issuers))
+	var failed []Issuer
+
+	for _, issuer := range m.Issuers {
+		if m.issuerFailed(ctx, name, issuer.Name()) {
+			failed = append(failed, issuer)
+		} else {
+			ordered = append(ordered, issuer)
+		}
+	}
+
+	return append(ordered, failed...)
+}
+
+func issuerFailureCacheKey(name, issuerName string) string {
+	return name + "+issuer-failed+" + issuerName
+}
+
+func (m *Manager) issuerFailed(ctx context.Context, name, issuerName string) bool {
+	_, err := m.Cache.Get(ctx, issuerFailureCacheKey(name, issuerName))
+	return err == nil
+}
+
+func (m *Manager) markIssuerFailed(ctx context.Context, name, issuerName string) {
+	if m.Cache == nil {
+		return
+	}
+	if err := m.Cache.Put(ctx, issuerFailureCacheKey(name, issuerName), []byte{1}); err != nil && m.DebugLog != nil {
+		m.DebugLog.Printf("autocert: cache issuer failure %q/%s: %v", name, issuerName, err)
+	}
+}
+
+func (m *Manager) clearIssuerFailed(ctx context.Context, name, issuerName string) {
+	if m.Cache == nil {
+		return
+	}
+	if err := m.Cache.Delete(ctx, issuerFailureCacheKey(name, issuerName)); err != nil && m.DebugLog != nil {
+		m.DebugLog.Printf("autocert: clear cached issuer failure %q/%s: %v", name, issuerName, err)
+	}
+}
+
+// loadCachedCertificate and storeCachedCertificate use the same PEM-blocks
+// encoding as golang.org/x/crypto/acme/autocert, so a Cache populated by one
+// can be read by the other.
+//
+// loadCachedCertificate returns an error (and so forces issueCertificate to
+// re-issue) once the cached certificate is within renewBefore of its
+// NotAfter, the same way the plain-Client path's internal.Manager renews on
+// its own schedule.
+func (m *Manager) loadCachedCertificate(ctx context.Context, name string) (*tls.Certificate, error) {
+	if m.Cache == nil {
+		return nil, errors.New("autocert: no cache configured")
+	}
+
+	data, err := m.Cache.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := decodeCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.needsRenewal(cert) {
+		return nil, errors.New("autocert: cached certificate is due for renewal")
+	}
+
+	return cert, nil
+}
+
+func (m *Manager) storeCachedCertificate(ctx context.Context, name string, cert *tls.Certificate) error {
+	data, err := encodeCertificate(cert)
+	if err != nil {
+		return err
+	}
+	return m.Cache.Put(ctx, name, data)
+}
+
+func encodeCertificate(cert *tls.Certificate) ([]byte, error) {
+	var buf []byte
+
+	for _, der := range cert.Certificate {
+		buf = append(buf, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+
+	return buf, nil
+}
+
+func decodeCertificate(data []byte) (*tls.Certificate, error) {
+	var cert tls.Certificate
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			cert.Certificate = append(cert.Certificate, block.Bytes)
+
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			cert.PrivateKey = key
+		}
+	}
+
+	if len(cert.Certificate) == 0 || cert.PrivateKey == nil {
+		return nil, errors.New("autocert: incomplete cached certificate")
+	}
+
+	return &cert, nil
+}
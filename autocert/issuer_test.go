@@ -0,0 +1,139 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// eabDirectory is a minimal fake ACME directory that requires External
+// Account Binding on new-account requests, the way ZeroSSL's and Google
+// Trust Services' endpoints do.  It fails the first failTimes new-account
+// requests with a server error before accepting one, so a test can tell
+// apart a sync.Once-style permanent failure from a retryable one.
+type eabDirectory struct {
+	srv        *httptest.Server
+	failTimes  int
+	newAccount int
+}
+
+func newEABDirectory(failTimes int) *eabDirectory {
+	d := &eabDirectory{failTimes: failTimes}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", d.directory)
+	mux.HandleFunc("/new-nonce", d.newNonce)
+	mux.HandleFunc("/new-account", d.newAccount_)
+	d.srv = httptest.NewServer(mux)
+	return d
+}
+
+func (d *eabDirectory) directory(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"newNonce":   d.srv.URL + "/new-nonce",
+		"newAccount": d.srv.URL + "/new-account",
+	})
+}
+
+func (d *eabDirectory) newNonce(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", "testnonce")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newAccount_ is named with a trailing underscore to avoid colliding with
+// the newAccount counter field.
+func (d *eabDirectory) newAccount_(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", "testnonce")
+
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		ExternalAccountBinding json.RawMessage `json:"externalAccountBinding"`
+	}
+	json.Unmarshal(payload, &body)
+	if len(body.ExternalAccountBinding) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"type": "urn:ietf:params:acme:error:externalAccountRequired"})
+		return
+	}
+
+	d.newAccount++
+	if d.newAccount <= d.failTimes {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", d.srv.URL+"/account/1")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "valid"})
+}
+
+func TestACMEIssuerRegisterRetriesAfterFailure(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := newEABDirectory(1) // first new-account attempt fails, second succeeds
+	defer dir.srv.Close()
+
+	i := &ACMEIssuer{
+		Client: &acme.Client{
+			Key:          key,
+			DirectoryURL: dir.srv.URL + "/directory",
+			// acme.Client retries 5xx responses on its own by default;
+			// disable that so the fake's server error reaches register.
+			RetryBackoff: func(int, *http.Request, *http.Response) time.Duration { return 0 },
+		},
+		EAB: &EABCredentials{
+			KeyID:   "kid-1",
+			HMACKey: base64.RawURLEncoding.EncodeToString([]byte("test-hmac-key-test-hmac-key-1234")),
+		},
+	}
+
+	if err := i.register(context.Background()); err == nil {
+		t.Fatal("expected the first (failing) registration attempt to return an error")
+	}
+	if i.registered {
+		t.Fatal("registered must not be set after a failed registration")
+	}
+
+	if err := i.register(context.Background()); err != nil {
+		t.Fatalf("retry after failure: %v", err)
+	}
+	if !i.registered {
+		t.Fatal("registered should be set after a successful registration")
+	}
+
+	if err := i.register(context.Background()); err != nil {
+		t.Fatalf("re-register after success should be a no-op: %v", err)
+	}
+	if dir.newAccount != 2 {
+		t.Fatalf("expected exactly 2 new-account requests (1 failed + 1 succeeded), got %d", dir.newAccount)
+	}
+}
@@ -11,6 +11,9 @@ package autocert
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,8 +24,24 @@ import (
 	internal "github.com/tsavola/acmedns/internal/acme/autocert"
 )
 
+// Challenge types accepted in ChallengeOrder.
+const (
+	DNS01     = "dns-01"
+	HTTP01    = "http-01"
+	TLSALPN01 = "tls-alpn-01"
+)
+
+const (
+	wellKnownPath  = "/.well-known/acme-challenge/"
+	alpnProto      = "acme-tls/1"
+	defaultHTTP    = ":80"
+	defaultTLSALPN = ":443"
+)
+
 // DNS knows what hosts exist in which zones, and can create/update TXT records
-// in those zones.  It doesn't have to be instantaneous.
+// in those zones.  It doesn't have to be instantaneous.  dns/dnszone.Container
+// is the built-in implementation; dns/dnsprovider.Adapter and
+// dns/libdnsadapter.Adapter plug in an off-box DNS host instead.
 type DNS interface {
 	acmedns.DNS
 
@@ -44,17 +63,225 @@ type Manager struct {
 	Email       string
 	ForceRSA    bool
 
+	// Propagation, if set, makes DNS-01 verification wait until the
+	// challenge record is visible on the zone's authoritative name servers
+	// before accepting the challenge.  dns/dnsprop.Config is the default
+	// implementation; supply your own acmedns.PropagationChecker for a
+	// split-horizon or hidden-primary setup.
+	Propagation acmedns.PropagationChecker
+
+	// EnableHTTP01 and EnableTLSALPN01 add the respective challenge types
+	// as fallbacks for hosts that DNS-01 can't handle (DisableDNS01, or a
+	// ResolveZone NotExist error).  At least one of DNS-01 (the default),
+	// HTTP-01, or TLS-ALPN-01 must end up enabled.
+	EnableHTTP01    bool
+	EnableTLSALPN01 bool
+	DisableDNS01    bool
+
+	// HTTPPort and TLSALPNPort are informational: they tell the caller
+	// which port HTTPHandler and TLSConfig expect to be served on
+	// (":80" and ":443" respectively, per RFC 8555).  They default
+	// accordingly and are not used by Manager itself.
+	HTTPPort    string
+	TLSALPNPort string
+
+	// ChallengeOrder selects which challenge types to attempt, and in
+	// which order, among the ones enabled above.  Defaults to
+	// {DNS01, HTTP01, TLSALPN01}, skipping any that aren't enabled.
+	ChallengeOrder []string
+
+	// Wildcards lists zones (without a trailing dot) for which
+	// GetCertificate requests and caches a single *.zone certificate
+	// instead of a per-host one.  Every hostname that resolves into such a
+	// zone is served the shared wildcard certificate.  WildcardPolicy
+	// takes precedence if set.  Wildcard issuance always goes through
+	// DNS-01, since it's the only challenge type that can prove control
+	// of a wildcard name.
+	Wildcards []string
+
+	// WildcardPolicy reports whether zone (as returned by DNS.ResolveZone,
+	// without a trailing dot) should get a shared wildcard certificate.
+	// Overrides Wildcards if set.
+	WildcardPolicy func(zone string) bool
+
+	// Issuers, if non-empty, replace Client as the source of certificates:
+	// GetCertificate builds a CSR itself and tries each Issuer in order,
+	// falling through to the next on failure (e.g. a rate-limited or
+	// outaged CA).  Unlike the Client path, this does not go through the
+	// internal Manager's own renewal machinery; Cache is still used to
+	// persist the result, as well as (if set) which issuer last failed
+	// for a given name, so the fallback order survives a restart.
+	Issuers []Issuer
+
+	// Events, if set, is called synchronously at key points of a
+	// certificate's lifecycle (see EventType).  It's the hook for
+	// integrating with monitoring, secret stores, or cluster distribution
+	// without patching Manager itself.
+	//
+	// Events only fires for the Issuers path: the plain Client path
+	// delegates issuance and renewal to the internal Manager, which has no
+	// event hook of its own.
+	Events EventHandler
+
 	DebugLog Logger // Defaults to nothingness
 
 	initOnce sync.Once
 	internal internal.Manager
+
+	httpMutex  sync.Mutex
+	httpTokens map[string]string // token -> key authorization
+
+	alpnMutex sync.Mutex
+	alpnCerts map[string]*tls.Certificate // SNI -> challenge certificate
 }
 
 func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	m.initOnce.Do(m.init)
+
+	if m.EnableTLSALPN01 && supportsALPNProto(hello) {
+		if cert, ok := m.alpnCert(hello.ServerName); ok {
+			return cert, nil
+		}
+	}
+
+	name := hello.ServerName
+	if wild, ok := m.wildcardName(name); ok {
+		name = wild
+	}
+
+	if len(m.Issuers) > 0 {
+		ctx := context.Background()
+		if err := m.hostPolicy(ctx, name); err != nil {
+			return nil, err
+		}
+		return m.issueCertificate(ctx, name)
+	}
+
+	if name != hello.ServerName {
+		// The internal Manager's own per-name state (cache key, in-flight
+		// ACME order) is keyed by ServerName, so every sibling hostname
+		// requesting "*.zone" here coalesces onto the same order for free.
+		wildHello := *hello
+		wildHello.ServerName = name
+		return m.lockedInternalGetCertificate(name, &wildHello)
+	}
+
+	return m.lockedInternalGetCertificate(name, hello)
+}
+
+// lockedInternalGetCertificate calls m.internal.GetCertificate, holding
+// Cache's distributed lock for name (if Cache is a DistributedCache) for
+// the duration of the call.  m.internal handles both initial issuance and
+// renewal internally (the same way golang.org/x/crypto/acme/autocert.Manager
+// does), and every one of those calls passes through here, so this is
+// enough to keep two nodes behind an anycast address from racing each
+// other's ACME orders, the same way issueCertificate's Issuers path does.
+func (m *Manager) lockedInternalGetCertificate(name string, hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	dc, ok := m.Cache.(DistributedCache)
+	if !ok {
+		return m.internal.GetCertificate(hello)
+	}
+
+	unlock, err := dc.Lock(context.Background(), name)
+	if err != nil {
+		return nil, fmt.Errorf("autocert: lock %q: %w", name, err)
+	}
+	defer unlock()
+
 	return m.internal.GetCertificate(hello)
 }
 
+// WildcardCacheKey returns the cache key (and ACME SNI name) under which the
+// shared wildcard certificate for zone (without a trailing dot) is stored,
+// so an external autocert.Cache implementation can locate it directly.
+func WildcardCacheKey(zone string) string {
+	return "*." + strings.TrimSuffix(zone, ".")
+}
+
+// wildcardName reports the wildcard SNI name that should be requested in
+// place of host, if host falls into a zone covered by Wildcards or
+// WildcardPolicy.
+func (m *Manager) wildcardName(host string) (name string, ok bool) {
+	if host == "" {
+		return "", false
+	}
+
+	zone, err := m.DNS.ResolveZone(context.Background(), host+".")
+	if err != nil {
+		return "", false
+	}
+	zone = strings.TrimSuffix(zone, ".")
+
+	if m.WildcardPolicy != nil {
+		ok = m.WildcardPolicy(zone)
+	} else {
+		for _, z := range m.Wildcards {
+			if strings.TrimSuffix(z, ".") == zone {
+				ok = true
+				break
+			}
+		}
+	}
+
+	if !ok {
+		return "", false
+	}
+	return WildcardCacheKey(zone), true
+}
+
+// HTTPHandler answers ACME HTTP-01 challenge requests and delegates every
+// other request to fallback (http.NotFound if nil).  The caller must serve
+// it on HTTPPort (":80" by default).
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	if fallback == nil {
+		fallback = http.HandlerFunc(http.NotFound)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.EnableHTTP01 || !strings.HasPrefix(r.URL.Path, wellKnownPath) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		token := strings.TrimPrefix(r.URL.Path, wellKnownPath)
+
+		keyAuth, ok := m.httpToken(token)
+		if !ok {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(keyAuth))
+	})
+}
+
+// TLSConfig returns a TLS configuration that serves managed certificates and
+// answers ACME TLS-ALPN-01 challenges.  The caller must serve it on
+// TLSALPNPort (":443" by default).
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1", alpnProto},
+	}
+}
+
+// HTTPAddr returns HTTPPort, or ":80" if it isn't set.
+func (m *Manager) HTTPAddr() string {
+	if m.HTTPPort != "" {
+		return m.HTTPPort
+	}
+	return defaultHTTP
+}
+
+// TLSALPNAddr returns TLSALPNPort, or ":443" if it isn't set.
+func (m *Manager) TLSALPNAddr() string {
+	if m.TLSALPNPort != "" {
+		return m.TLSALPNPort
+	}
+	return defaultTLSALPN
+}
+
 func (m *Manager) init() {
 	m.internal = internal.Manager{
 		Prompt:      m.Prompt,
@@ -68,7 +295,47 @@ func (m *Manager) init() {
 	}
 }
 
+func (m *Manager) challengeOrder() []string {
+	order := m.ChallengeOrder
+	if order == nil {
+		order = []string{DNS01, HTTP01, TLSALPN01}
+	}
+
+	var enabled []string
+	for _, typ := range order {
+		switch typ {
+		case DNS01:
+			if !m.DisableDNS01 {
+				enabled = append(enabled, typ)
+			}
+		case HTTP01:
+			if m.EnableHTTP01 {
+				enabled = append(enabled, typ)
+			}
+		case TLSALPN01:
+			if m.EnableTLSALPN01 {
+				enabled = append(enabled, typ)
+			}
+		}
+	}
+	return enabled
+}
+
+// notExister is implemented by a ResolveZone error that reports a
+// definitive "no such host", as opposed to e.g. a transient lookup
+// failure.  dns/dnszone, dns/dnsprovider and dns/libdnsadapter all return
+// one from a clean NXDOMAIN-equivalent result.
+type notExister interface {
+	NotExist() bool
+}
+
 func (m *Manager) hostPolicy(ctx context.Context, host string) (err error) {
+	if m.DisableDNS01 {
+		// DNS-01 is disabled outright, so there's no zone to gate on:
+		// verify's per-challenge-type fallthrough decides for every name.
+		return nil
+	}
+
 	if m.DebugLog != nil {
 		m.DebugLog.Printf("autocert: %q", host)
 	}
@@ -79,19 +346,170 @@ func (m *Manager) hostPolicy(ctx context.Context, host string) (err error) {
 		m.DebugLog.Printf("autocert: %v", err)
 	}
 
+	if ne, ok := err.(notExister); ok && ne.NotExist() && (m.EnableHTTP01 || m.EnableTLSALPN01) {
+		// host just isn't in a DNS-01-manageable zone; let verify's
+		// fallthrough to HTTP-01/TLS-ALPN-01 have a try instead of
+		// failing the request here on its behalf.
+		return nil
+	}
+
 	return
 }
 
 func (m *Manager) verify(ctx context.Context, client *acme.Client, serverName string) (err error) {
+	for _, typ := range m.challengeOrder() {
+		switch typ {
+		case DNS01:
+			err = m.verifyDNS01(ctx, client, serverName)
+
+		case HTTP01:
+			err = m.verifyHTTP01(ctx, client, serverName)
+
+		case TLSALPN01:
+			err = m.verifyTLSALPN01(ctx, client, serverName)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		if m.DebugLog != nil {
+			m.DebugLog.Printf("autocert: %s: %v", typ, err)
+		}
+	}
+
+	return
+}
+
+func (m *Manager) verifyDNS01(ctx context.Context, client *acme.Client, serverName string) error {
+	// A NotExist error falls through to whichever challenge type is next
+	// in m.challengeOrder(), same as any other error.
 	zone, err := m.DNS.ResolveZone(ctx, serverName+".")
 	if err != nil {
+		return err
+	}
+
+	return acmedns.Verify(ctx, m.Client, m.DNS, serverName, zone, m.Propagation)
+}
+
+func (m *Manager) verifyHTTP01(ctx context.Context, client *acme.Client, serverName string) error {
+	authz, err := client.Authorize(ctx, serverName)
+	if err != nil {
+		return err
 	}
 
-	err = acmedns.Verify(ctx, m.Client, m.DNS, serverName, zone)
+	chal, err := findChallenge(authz, HTTP01)
+	if err != nil {
+		return err
+	}
 
-	if err != nil && m.DebugLog != nil {
-		m.DebugLog.Printf("autocert: %v", err)
+	keyAuth, err := client.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return err
 	}
 
-	return
+	m.putHTTPToken(chal.Token, keyAuth)
+	defer m.deleteHTTPToken(chal.Token)
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+func (m *Manager) verifyTLSALPN01(ctx context.Context, client *acme.Client, serverName string) error {
+	authz, err := client.Authorize(ctx, serverName)
+	if err != nil {
+		return err
+	}
+
+	chal, err := findChallenge(authz, TLSALPN01)
+	if err != nil {
+		return err
+	}
+
+	cert, err := client.TLSALPN01ChallengeCert(chal.Token, serverName)
+	if err != nil {
+		return err
+	}
+
+	m.putALPNCert(serverName, &cert)
+	defer m.deleteALPNCert(serverName)
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+func findChallenge(authz *acme.Authorization, typ string) (*acme.Challenge, error) {
+	for _, chal := range authz.Challenges {
+		if chal.Type == typ {
+			return chal, nil
+		}
+	}
+	return nil, &challengeUnavailableError{typ}
+}
+
+func (m *Manager) httpToken(token string) (string, bool) {
+	m.httpMutex.Lock()
+	defer m.httpMutex.Unlock()
+	keyAuth, ok := m.httpTokens[token]
+	return keyAuth, ok
+}
+
+func (m *Manager) putHTTPToken(token, keyAuth string) {
+	m.httpMutex.Lock()
+	defer m.httpMutex.Unlock()
+	if m.httpTokens == nil {
+		m.httpTokens = make(map[string]string)
+	}
+	m.httpTokens[token] = keyAuth
+}
+
+func (m *Manager) deleteHTTPToken(token string) {
+	m.httpMutex.Lock()
+	defer m.httpMutex.Unlock()
+	delete(m.httpTokens, token)
+}
+
+func (m *Manager) alpnCert(serverName string) (*tls.Certificate, bool) {
+	m.alpnMutex.Lock()
+	defer m.alpnMutex.Unlock()
+	cert, ok := m.alpnCerts[serverName]
+	return cert, ok
+}
+
+func (m *Manager) putALPNCert(serverName string, cert *tls.Certificate) {
+	m.alpnMutex.Lock()
+	defer m.alpnMutex.Unlock()
+	if m.alpnCerts == nil {
+		m.alpnCerts = make(map[string]*tls.Certificate)
+	}
+	m.alpnCerts[serverName] = cert
+}
+
+func (m *Manager) deleteALPNCert(serverName string) {
+	m.alpnMutex.Lock()
+	defer m.alpnMutex.Unlock()
+	delete(m.alpnCerts, serverName)
+}
+
+func supportsALPNProto(hello *tls.ClientHelloInfo) bool {
+	for _, proto := range hello.SupportedProtos {
+		if proto == alpnProto {
+			return true
+		}
+	}
+	return false
+}
+
+type challengeUnavailableError struct {
+	typ string
+}
+
+func (e *challengeUnavailableError) Error() string {
+	return "autocert: CA didn't offer a " + e.typ + " challenge"
 }
@@ -0,0 +1,120 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeDNS is a minimal DNS for exercising hostPolicy/wildcardName without a
+// real zone lookup.  zones maps a host (with trailing dot) to the domain
+// ResolveZone should report it belongs to; a host absent from zones gets
+// notExistErr if it is set (e.g. a plain lookup error), or else a
+// fakeNotExistError.
+type fakeDNS struct {
+	zones       map[string]string
+	notExistErr error
+}
+
+func (d *fakeDNS) AppendTXTValue(ctx context.Context, zone, node, value string, ttl uint32) error {
+	return errors.New("fakeDNS: AppendTXTValue not implemented")
+}
+
+func (d *fakeDNS) RemoveTXTValue(zone, node, value string) error {
+	return errors.New("fakeDNS: RemoveTXTValue not implemented")
+}
+
+func (d *fakeDNS) ResolveZone(ctx context.Context, hostname string) (string, error) {
+	if zone, ok := d.zones[hostname]; ok {
+		return zone, nil
+	}
+	if d.notExistErr != nil {
+		return "", d.notExistErr
+	}
+	return "", &fakeNotExistError{hostname}
+}
+
+type fakeNotExistError struct{ host string }
+
+func (e *fakeNotExistError) Error() string { return "fakeDNS: no such host: " + e.host }
+func (*fakeNotExistError) NotExist() bool  { return true }
+
+type fakeLookupError struct{ host string }
+
+func (e *fakeLookupError) Error() string { return "fakeDNS: lookup failed: " + e.host }
+
+func TestHostPolicyDisableDNS01SkipsLookup(t *testing.T) {
+	m := &Manager{DNS: nil, DisableDNS01: true}
+
+	if err := m.hostPolicy(context.Background(), "host.example.org"); err != nil {
+		t.Fatalf("hostPolicy = %v, want nil (DNS should never even be consulted)", err)
+	}
+}
+
+func TestHostPolicyKnownZoneSucceeds(t *testing.T) {
+	m := &Manager{DNS: &fakeDNS{zones: map[string]string{"host.example.org.": "example.org."}}}
+
+	if err := m.hostPolicy(context.Background(), "host.example.org"); err != nil {
+		t.Fatalf("hostPolicy = %v, want nil", err)
+	}
+}
+
+func TestHostPolicyNotExistFallsThroughWhenFallbackEnabled(t *testing.T) {
+	m := &Manager{DNS: &fakeDNS{}, EnableHTTP01: true}
+
+	if err := m.hostPolicy(context.Background(), "host.example.org"); err != nil {
+		t.Fatalf("hostPolicy = %v, want nil (HTTP-01 fallback should absorb a NotExist)", err)
+	}
+}
+
+func TestHostPolicyNotExistFailsWithoutFallback(t *testing.T) {
+	m := &Manager{DNS: &fakeDNS{}}
+
+	if err := m.hostPolicy(context.Background(), "host.example.org"); err == nil {
+		t.Fatal("hostPolicy = nil, want an error: no fallback challenge type is enabled")
+	}
+}
+
+func TestHostPolicyTransientLookupErrorIsNeverAbsorbed(t *testing.T) {
+	m := &Manager{
+		DNS:          &fakeDNS{notExistErr: &fakeLookupError{"host.example.org"}},
+		EnableHTTP01: true,
+	}
+
+	if err := m.hostPolicy(context.Background(), "host.example.org"); err == nil {
+		t.Fatal("hostPolicy = nil, want an error: a non-NotExist error must never be swallowed")
+	}
+}
+
+func TestChallengeOrderDefaultsAndFiltersDisabled(t *testing.T) {
+	m := &Manager{EnableHTTP01: true}
+
+	if got, want := m.challengeOrder(), []string{DNS01, HTTP01}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("challengeOrder() = %v, want %v", got, want)
+	}
+}
+
+func TestChallengeOrderDisableDNS01(t *testing.T) {
+	m := &Manager{DisableDNS01: true, EnableHTTP01: true, EnableTLSALPN01: true}
+
+	if got, want := m.challengeOrder(), []string{HTTP01, TLSALPN01}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("challengeOrder() = %v, want %v", got, want)
+	}
+}
+
+func TestChallengeOrderRespectsExplicitOrder(t *testing.T) {
+	m := &Manager{
+		EnableHTTP01:    true,
+		EnableTLSALPN01: true,
+		ChallengeOrder:  []string{TLSALPN01, HTTP01, DNS01},
+	}
+
+	if got, want := m.challengeOrder(), []string{TLSALPN01, HTTP01, DNS01}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("challengeOrder() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import "testing"
+
+func TestWildcardNameUsesWildcards(t *testing.T) {
+	m := &Manager{
+		DNS:       &fakeDNS{zones: map[string]string{"host.example.org.": "example.org."}},
+		Wildcards: []string{"example.org"},
+	}
+
+	name, ok := m.wildcardName("host.example.org")
+	if !ok {
+		t.Fatal("wildcardName: ok = false, want true")
+	}
+	if want := "*.example.org"; name != want {
+		t.Fatalf("wildcardName = %q, want %q", name, want)
+	}
+}
+
+func TestWildcardNameUsesWildcardPolicyOverWildcards(t *testing.T) {
+	m := &Manager{
+		DNS:       &fakeDNS{zones: map[string]string{"host.example.org.": "example.org."}},
+		Wildcards: []string{"example.org"},
+		WildcardPolicy: func(zone string) bool {
+			return false
+		},
+	}
+
+	if _, ok := m.wildcardName("host.example.org"); ok {
+		t.Fatal("wildcardName: ok = true, want false: WildcardPolicy should override Wildcards")
+	}
+}
+
+func TestWildcardNameNoMatch(t *testing.T) {
+	m := &Manager{
+		DNS:       &fakeDNS{zones: map[string]string{"host.example.org.": "example.org."}},
+		Wildcards: []string{"other.org"},
+	}
+
+	if _, ok := m.wildcardName("host.example.org"); ok {
+		t.Fatal("wildcardName: ok = true, want false")
+	}
+}
+
+func TestWildcardNameUnresolvableHost(t *testing.T) {
+	m := &Manager{DNS: &fakeDNS{}, Wildcards: []string{"example.org"}}
+
+	if _, ok := m.wildcardName("host.example.org"); ok {
+		t.Fatal("wildcardName: ok = true, want false: ResolveZone failed")
+	}
+}
+
+func TestWildcardCacheKey(t *testing.T) {
+	for _, tc := range []struct{ zone, want string }{
+		{"example.org", "*.example.org"},
+		{"example.org.", "*.example.org"},
+	} {
+		if got := WildcardCacheKey(tc.zone); got != tc.want {
+			t.Errorf("WildcardCacheKey(%q) = %q, want %q", tc.zone, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autocert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const zeroSSLAPI = "https://api.zerossl.com"
+
+// ZeroSSLIssuer is an Issuer backed by ZeroSSL's REST API
+// (https://zerossl.com/documentation/api/), which predates ZeroSSL's ACME
+// endpoint.  It's a useful fallback behind an ACMEIssuer when Let's
+// Encrypt is rate-limited or down.
+//
+// Domain control is proven with the "HTTP_CSR_HASH" method: DNS publishes
+// the validation value as the TXT record the request already uses for
+// ACME's DNS-01 challenge, so it reuses Manager's existing DNS backend
+// instead of requiring a separate HTTP file server.
+type ZeroSSLIssuer struct {
+	APIKey string
+	DNS    DNS // publishes the validation TXT record
+
+	HTTPClient   *http.Client  // defaults to http.DefaultClient
+	PollInterval time.Duration // defaults to 5s
+	PollTimeout  time.Duration // defaults to 5 minutes
+}
+
+func (i *ZeroSSLIssuer) Name() string { return "zerossl" }
+
+func (i *ZeroSSLIssuer) Issue(ctx context.Context, csr *x509.CertificateRequest) (*tls.Certificate, error) {
+	if len(csr.DNSNames) != 1 {
+		return nil, fmt.Errorf("autocert/zerossl: exactly one DNS SAN is required, got %d", len(csr.DNSNames))
+	}
+	domain := csr.DNSNames[0]
+
+	zone, err := i.DNS.ResolveZone(ctx, domain+".")
+	if err != nil {
+		return nil, fmt.Errorf("autocert/zerossl: %w", err)
+	}
+
+	cert, err := i.create(ctx, domain, csr.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := i.fulfill(ctx, zone, domain, cert)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, v := range values {
+			i.DNS.RemoveTXTValue(zone, zeroSSLChallengeNode, v)
+		}
+	}()
+
+	if err := i.verify(ctx, cert.ID); err != nil {
+		return nil, err
+	}
+
+	return i.download(ctx, cert.ID)
+}
+
+type zeroSSLCertificate struct {
+	ID         string                              `json:"id"`
+	Validation zeroSSLValidationByCollectionOrOther `json:"validation"`
+}
+
+type zeroSSLValidationByCollectionOrOther struct {
+	OtherMethods map[string]zeroSSLOtherMethod `json:"other_methods"`
+}
+
+type zeroSSLOtherMethod struct {
+	FileValidationURL     string   `json:"file_validation_url_http"`
+	FileValidationContent []string `json:"file_validation_content"`
+	CNAMEValidationP1     string   `json:"cname_validation_p1"`
+	CNAMEValidationP2     string   `json:"cname_validation_p2"`
+}
+
+func (i *ZeroSSLIssuer) create(ctx context.Context, domain string, csrDER []byte) (*zeroSSLCertificate, error) {
+	csrPEM := pemEncodeCSR(csrDER)
+
+	form := url.Values{
+		"certificate_domains":       {domain},
+		"certificate_csr":           {csrPEM},
+		"certificate_validity_days": {"90"},
+	}
+
+	var out zeroSSLCertificate
+	if err := i.post(ctx, "/certificates?access_key="+i.APIKey, form, &out); err != nil {
+		return nil, fmt.Errorf("autocert/zerossl: create certificate: %w", err)
+	}
+	return &out, nil
+}
+
+// fulfill publishes the validation values ZeroSSL asked for as TXT records,
+// at the same (zone, node) ACME's DNS-01 solver uses for zone.  It appends
+// rather than replaces, so it doesn't clobber an ACME dns-01 challenge that
+// happens to be pending for the same domain via another Issuer.  It returns
+// the values it published, so the caller can remove exactly those again.
+func (i *ZeroSSLIssuer) fulfill(ctx context.Context, zone, domain string, cert *zeroSSLCertificate) ([]string, error) {
+	method, ok := cert.Validation.OtherMethods[domain]
+	if !ok {
+		return nil, fmt.Errorf("autocert/zerossl: no validation method offered for %s", domain)
+	}
+	if len(method.FileValidationContent) == 0 {
+		return nil, fmt.Errorf("autocert/zerossl: no validation content offered for %s", domain)
+	}
+
+	for _, v := range method.FileValidationContent {
+		if err := i.DNS.AppendTXTValue(ctx, zone, zeroSSLChallengeNode, v, 1); err != nil {
+			return nil, fmt.Errorf("autocert/zerossl: publish validation TXT record: %w", err)
+		}
+	}
+
+	return method.FileValidationContent, nil
+}
+
+func (i *ZeroSSLIssuer) verify(ctx context.Context, id string) error {
+	var ack struct {
+		Success bool `json:"success"`
+	}
+	if err := i.post(ctx, "/certificates/"+id+"/challenges?access_key="+i.APIKey, url.Values{"validation_method": {"HTTP_CSR_HASH"}}, &ack); err != nil {
+		return fmt.Errorf("autocert/zerossl: request validation: %w", err)
+	}
+
+	timeout := i.PollTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+	interval := i.PollInterval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		var status struct {
+			Status string `json:"status"`
+		}
+		if err := i.get(ctx, "/certificates/"+id+"?access_key="+i.APIKey, &status); err != nil {
+			return fmt.Errorf("autocert/zerossl: poll status: %w", err)
+		}
+
+		switch status.Status {
+		case "issued":
+			return nil
+		case "cancelled", "expired":
+			return fmt.Errorf("autocert/zerossl: certificate %s", status.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("autocert/zerossl: %w waiting for issuance", ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (i *ZeroSSLIssuer) download(ctx context.Context, id string) (*tls.Certificate, error) {
+	var bundle struct {
+		CertificateCrt string `json:"certificate.crt"`
+		CABundleCrt    string `json:"ca_bundle.crt"`
+	}
+	if err := i.get(ctx, "/certificates/"+id+"/download/return?access_key="+i.APIKey, &bundle); err != nil {
+		return nil, fmt.Errorf("autocert/zerossl: download: %w", err)
+	}
+
+	data := []byte(bundle.CertificateCrt + bundle.CABundleCrt)
+
+	var der [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			der = append(der, block.Bytes)
+		}
+	}
+	if len(der) == 0 {
+		return nil, fmt.Errorf("autocert/zerossl: empty certificate chain for %s", id)
+	}
+
+	return &tls.Certificate{Certificate: der}, nil
+}
+
+func (i *ZeroSSLIssuer) client() *http.Client {
+	if i.HTTPClient != nil {
+		return i.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (i *ZeroSSLIssuer) post(ctx context.Context, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, zeroSSLAPI+path, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return i.do(req, out)
+}
+
+func (i *ZeroSSLIssuer) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, zeroSSLAPI+path, nil)
+	if err != nil {
+		return err
+	}
+	return i.do(req, out)
+}
+
+func (i *ZeroSSLIssuer) do(req *http.Request, out interface{}) error {
+	resp, err := i.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+const (
+	zeroSSLChallengeNode = "_acme-challenge" // reuses the ACME DNS-01 node
+)
+
+func pemEncodeCSR(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dnsprop checks that a TXT record has propagated to a zone's
+// authoritative name servers.  It is used to delay handing an ACME DNS-01
+// challenge to the CA until slave name servers (step 7 of the top-level
+// package's setup) have actually picked up the record, which avoids a
+// common source of validation failures with hidden-primary setups.
+//
+// See the top-level package for general documentation.
+package dnsprop
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	defaultServerTimeout = 5 * time.Second
+	defaultDeadline      = 2 * time.Minute
+	initialBackoff       = 500 * time.Millisecond
+	maxBackoff           = 10 * time.Second
+)
+
+// Config controls how Check polls a zone's authoritative name servers.  The
+// zero value is usable and checks every name server with reasonable
+// defaults.
+type Config struct {
+	// Resolver is used to look up the zone's NS records and to resolve
+	// those NS hostnames to addresses.  Defaults to net.DefaultResolver.
+	Resolver *net.Resolver
+
+	// ServerTimeout bounds a single query to a single authoritative
+	// server.  Defaults to 5 seconds.
+	ServerTimeout time.Duration
+
+	// Deadline bounds the whole check, across retries.  Defaults to 2
+	// minutes.
+	Deadline time.Duration
+
+	// Quorum is the number of authoritative servers that must agree on
+	// the value before Check succeeds.  Zero (or a value greater than the
+	// number of servers) means all of them.
+	Quorum int
+
+	// serverPort overrides the authoritative server port, which is
+	// otherwise always 53.  It exists so tests can bind fake servers to an
+	// unprivileged ephemeral port instead of the real DNS port.
+	serverPort string
+}
+
+// Check polls zone's authoritative name servers until Quorum of them answer
+// fqdn's TXT query with value, or the deadline expires.  It follows CNAME
+// chains and falls back to TCP when a server is UDP-truncated or TCP-only.
+func (c Config) Check(ctx context.Context, zone, fqdn, value string) error {
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	serverTimeout := c.ServerTimeout
+	if serverTimeout == 0 {
+		serverTimeout = defaultServerTimeout
+	}
+
+	deadline := c.Deadline
+	if deadline == 0 {
+		deadline = defaultDeadline
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+
+	servers, err := resolver.LookupNS(ctx, zone)
+	if err != nil {
+		return fmt.Errorf("dnsprop: lookup NS for %s: %w", zone, err)
+	}
+	if len(servers) == 0 {
+		return fmt.Errorf("dnsprop: no NS records for %s", zone)
+	}
+
+	quorum := c.Quorum
+	if quorum <= 0 || quorum > len(servers) {
+		quorum = len(servers)
+	}
+
+	backoff := initialBackoff
+
+	for {
+		agreed, lastErr := c.poll(ctx, resolver, servers, fqdn, value, serverTimeout)
+		if agreed >= quorum {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			return fmt.Errorf("dnsprop: propagation incomplete (%d/%d of %d servers): %w", agreed, quorum, len(servers), lastErr)
+
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (c Config) poll(ctx context.Context, resolver *net.Resolver, servers []*net.NS, fqdn, value string, timeout time.Duration) (agreed int, lastErr error) {
+	for _, ns := range servers {
+		if err := c.queryServer(ctx, resolver, ns.Host, fqdn, value, timeout); err != nil {
+			lastErr = err
+			continue
+		}
+		agreed++
+	}
+	return
+}
+
+func (c Config) queryServer(ctx context.Context, resolver *net.Resolver, host, fqdn, value string, timeout time.Duration) error {
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%s: %w", host, err)
+	}
+
+	port := c.serverPort
+	if port == "" {
+		port = "53"
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		values, err := queryTXT(net.JoinHostPort(addr, port), fqdn, timeout, 0)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", host, err)
+			continue
+		}
+
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+		lastErr = fmt.Errorf("%s: value not yet present", host)
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%s: no usable address", host)
+	}
+	return lastErr
+}
+
+// queryTXT asks addr directly for fqdn's TXT records, following CNAME chains
+// up to a handful of hops, and retrying over TCP if the UDP answer was
+// truncated or the UDP query itself failed (e.g. timed out against a
+// TCP-only server).
+func queryTXT(addr, fqdn string, timeout time.Duration, depth int) ([]string, error) {
+	if depth > 5 {
+		return nil, fmt.Errorf("CNAME chain too long")
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(fqdn), dns.TypeTXT)
+
+	client := &dns.Client{Net: "udp", Timeout: timeout}
+	in, _, err := client.Exchange(msg, addr)
+	if err != nil || (in != nil && in.Truncated) {
+		client.Net = "tcp"
+		in, _, err = client.Exchange(msg, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, rr := range in.Answer {
+		switch r := rr.(type) {
+		case *dns.TXT:
+			values = append(values, strings.Join(r.Txt, ""))
+
+		case *dns.CNAME:
+			more, err := queryTXT(addr, r.Target, timeout, depth+1)
+			if err == nil {
+				values = append(values, more...)
+			}
+		}
+	}
+	return values, nil
+}
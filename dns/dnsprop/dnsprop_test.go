@@ -0,0 +1,197 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsprop
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	dnsclient "github.com/miekg/dns"
+)
+
+// startFake runs handler as a UDP and TCP authoritative server on addr,
+// so a test can drive queryTXT the same way it would talk to a real name
+// server (including its own UDP-truncated-retry-over-TCP logic).  It's torn
+// down when t ends.
+func startFake(t *testing.T, addr string, handler dnsclient.HandlerFunc) {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatalf("listen udp %s: %v", addr, err)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		pc.Close()
+		t.Fatalf("listen tcp %s: %v", addr, err)
+	}
+
+	go dnsclient.ActivateAndServe(nil, pc, handler)
+	go dnsclient.ActivateAndServe(ln, nil, handler)
+
+	t.Cleanup(func() {
+		pc.Close()
+		ln.Close()
+	})
+}
+
+func txtReply(req *dnsclient.Msg, name, value string) *dnsclient.Msg {
+	reply := new(dnsclient.Msg)
+	reply.SetReply(req)
+	reply.Answer = append(reply.Answer, &dnsclient.TXT{
+		Hdr: dnsclient.RR_Header{Name: name, Rrtype: dnsclient.TypeTXT, Class: dnsclient.ClassINET, Ttl: 1},
+		Txt: []string{value},
+	})
+	return reply
+}
+
+func TestQueryTXTFollowsCNAMEChain(t *testing.T) {
+	const (
+		addr  = "127.0.7.1:15301"
+		fqdn  = "_acme-challenge.example.org."
+		alias = "_acme-challenge.example.net."
+		value = "the-challenge-value"
+	)
+
+	startFake(t, addr, dnsclient.HandlerFunc(func(w dnsclient.ResponseWriter, req *dnsclient.Msg) {
+		defer w.Close()
+
+		name := req.Question[0].Name
+		switch name {
+		case fqdn:
+			reply := new(dnsclient.Msg)
+			reply.SetReply(req)
+			reply.Answer = append(reply.Answer, &dnsclient.CNAME{
+				Hdr:    dnsclient.RR_Header{Name: fqdn, Rrtype: dnsclient.TypeCNAME, Class: dnsclient.ClassINET, Ttl: 1},
+				Target: alias,
+			})
+			w.WriteMsg(reply)
+
+		case alias:
+			w.WriteMsg(txtReply(req, alias, value))
+
+		default:
+			w.WriteMsg(new(dnsclient.Msg).SetRcode(req, dnsclient.RcodeNameError))
+		}
+	}))
+
+	values, err := queryTXT(addr, fqdn, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 1 || values[0] != value {
+		t.Fatalf("queryTXT = %v, want [%q]", values, value)
+	}
+}
+
+func TestQueryTXTRetriesOverTCPWhenTruncated(t *testing.T) {
+	const (
+		addr  = "127.0.7.2:15302"
+		fqdn  = "_acme-challenge.example.org."
+		value = "the-challenge-value"
+	)
+
+	startFake(t, addr, dnsclient.HandlerFunc(func(w dnsclient.ResponseWriter, req *dnsclient.Msg) {
+		defer w.Close()
+
+		if _, isUDP := w.RemoteAddr().(*net.UDPAddr); isUDP {
+			reply := new(dnsclient.Msg)
+			reply.SetReply(req)
+			reply.Truncated = true
+			w.WriteMsg(reply)
+			return
+		}
+
+		w.WriteMsg(txtReply(req, fqdn, value))
+	}))
+
+	values, err := queryTXT(addr, fqdn, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 1 || values[0] != value {
+		t.Fatalf("queryTXT = %v, want [%q]", values, value)
+	}
+}
+
+// TestQueryTXTRetriesOverTCPWhenUDPFails covers a TCP-only authoritative
+// server: nothing is listening on the UDP port, so the initial UDP Exchange
+// fails outright (rather than coming back Truncated), and queryTXT must
+// still fall back to TCP instead of giving up.
+func TestQueryTXTRetriesOverTCPWhenUDPFails(t *testing.T) {
+	const (
+		addr  = "127.0.7.3:15303"
+		fqdn  = "_acme-challenge.example.org."
+		value = "the-challenge-value"
+	)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listen tcp %s: %v", addr, err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go dnsclient.ActivateAndServe(ln, nil, dnsclient.HandlerFunc(func(w dnsclient.ResponseWriter, req *dnsclient.Msg) {
+		defer w.Close()
+		w.WriteMsg(txtReply(req, fqdn, value))
+	}))
+
+	values, err := queryTXT(addr, fqdn, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 1 || values[0] != value {
+		t.Fatalf("queryTXT = %v, want [%q]", values, value)
+	}
+}
+
+func TestPollQuorum(t *testing.T) {
+	const (
+		fqdn  = "_acme-challenge.example.org."
+		value = "the-challenge-value"
+	)
+
+	const port = "15310"
+
+	// Two servers answer with the right value, one answers NXDOMAIN.
+	agreeing := []string{"127.0.7.10", "127.0.7.11"}
+	for _, ip := range agreeing {
+		ip := ip
+		startFake(t, net.JoinHostPort(ip, port), dnsclient.HandlerFunc(func(w dnsclient.ResponseWriter, req *dnsclient.Msg) {
+			defer w.Close()
+			w.WriteMsg(txtReply(req, fqdn, value))
+		}))
+	}
+	startFake(t, net.JoinHostPort("127.0.7.12", port), dnsclient.HandlerFunc(func(w dnsclient.ResponseWriter, req *dnsclient.Msg) {
+		defer w.Close()
+		w.WriteMsg(new(dnsclient.Msg).SetRcode(req, dnsclient.RcodeNameError))
+	}))
+
+	servers := []*net.NS{
+		{Host: "127.0.7.10"},
+		{Host: "127.0.7.11"},
+		{Host: "127.0.7.12"},
+	}
+
+	c := Config{serverPort: port}
+	agreed, err := c.poll(context.Background(), net.DefaultResolver, servers, fqdn, value, time.Second)
+	if err != nil {
+		t.Log("poll lastErr:", err)
+	}
+	if agreed != 2 {
+		t.Fatalf("agreed = %d, want 2", agreed)
+	}
+
+	// A quorum of all 3 is not met; a quorum of 2 is.
+	if agreed >= len(servers) {
+		t.Fatalf("agreed (%d) unexpectedly met the full-quorum threshold of %d", agreed, len(servers))
+	}
+}
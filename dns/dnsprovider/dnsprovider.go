@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dnsprovider adapts a small libdns-style provider contract (append
+// and delete records in a zone you don't host yourself) to acmedns.DNS, so
+// any off-box DNS host -- Route 53, Cloudflare, Hetzner, DigitalOcean, or a
+// plain RFC 2136 dynamic-update server -- can serve ACME's DNS-01
+// challenges without running this module's own dns/dnsserver.
+//
+// See the top-level package for general documentation.
+package dnsprovider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-acme/lego/challenge/dns01"
+
+	"github.com/tsavola/acmedns/dns/dnsprop"
+)
+
+// Record is a single DNS resource record, in the shape Provider deals in.
+type Record struct {
+	Name  string // relative to the zone; "@" or "" denotes the zone apex
+	Type  string
+	Value string
+	TTL   time.Duration
+}
+
+// Provider manages records in a zone it (or whatever it delegates to) is
+// authoritative over.
+type Provider interface {
+	AppendRecords(ctx context.Context, zone string, records []Record) ([]Record, error)
+	DeleteRecords(ctx context.Context, zone string, records []Record) error
+}
+
+// Adapter implements acmedns.DNS and autocert.DNS on top of a Provider.
+type Adapter struct {
+	Provider Provider
+
+	// Propagation bounds how long AppendTXTValue waits for value to become
+	// visible on every one of zone's authoritative name servers before
+	// giving up. A third-party provider's API typically acknowledges a
+	// write well before the record is actually being served, so this is
+	// what makes AppendTXTValue's "blocks until complete" promise honest.
+	// The zero value is usable and checks every name server with
+	// dnsprop.Config's own defaults.
+	Propagation dnsprop.Config
+}
+
+// New creates an Adapter wrapping provider, with default propagation
+// timing.
+func New(provider Provider) *Adapter {
+	return &Adapter{Provider: provider}
+}
+
+// ResolveZone checks the existence of a host by finding its enclosing zone
+// via SOA lookup, the same way dns01.FindZoneByFqdn does it for lego's own
+// DNS-01 solvers.
+func (a *Adapter) ResolveZone(ctx context.Context, hostname string) (domain string, err error) {
+	domain, err = dns01.FindZoneByFqdn(hostname)
+	if err != nil {
+		return "", &existenceError{name: hostname, reason: err.Error()}
+	}
+	return domain, nil
+}
+
+// AppendTXTValue implements acmedns.DNS and autocert.DNS. It asks Provider
+// to add value, then blocks until a.Propagation observes value being
+// answered by zone's authoritative name servers.
+func (a *Adapter) AppendTXTValue(ctx context.Context, zone, node, value string, ttl uint32) error {
+	if _, err := a.Provider.AppendRecords(ctx, zone, []Record{{
+		Name:  node,
+		Type:  "TXT",
+		Value: value,
+		TTL:   time.Duration(ttl) * time.Second,
+	}}); err != nil {
+		return fmt.Errorf("dnsprovider: append %s.%s TXT record: %w", node, zone, err)
+	}
+
+	if err := a.Propagation.Check(ctx, zone, node+"."+zone, value); err != nil {
+		return fmt.Errorf("dnsprovider: %w", err)
+	}
+	return nil
+}
+
+// RemoveTXTValue implements acmedns.DNS and autocert.DNS. Only the given
+// value is removed; any other values at node are left alone.
+func (a *Adapter) RemoveTXTValue(zone, node, value string) error {
+	return a.Provider.DeleteRecords(context.Background(), zone, []Record{{
+		Name:  node,
+		Type:  "TXT",
+		Value: value,
+	}})
+}
+
+type existenceError struct {
+	name   string
+	reason string
+}
+
+func (e *existenceError) Error() string {
+	return fmt.Sprintf("dnsprovider: %s: %s", e.name, e.reason)
+}
+
+func (*existenceError) NotExist() bool {
+	return true
+}
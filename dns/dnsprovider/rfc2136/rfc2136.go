@@ -0,0 +1,116 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rfc2136 implements dnsprovider.Provider using RFC 2136 DNS UPDATE
+// messages, optionally authenticated with TSIG. It's a reference
+// implementation for any authoritative server that speaks the
+// dynamic-update protocol (BIND, PowerDNS, Knot, ...), so that plugging in
+// an off-box DNS backend doesn't require a provider-specific REST API
+// client -- staying in the "just DNS protocol" spirit of the top-level
+// package.
+package rfc2136
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/tsavola/acmedns/dns/dnsprovider"
+)
+
+// Provider manages records in zone via RFC 2136 dynamic updates sent to
+// Server.
+type Provider struct {
+	// Server is the authoritative name server's address, e.g.
+	// "ns1.example.org:53".
+	Server string
+
+	// TSIGKey and TSIGSecret authenticate the update, in the form
+	// github.com/miekg/dns expects (base64 secret). Leave both empty to
+	// send unsigned updates.
+	TSIGKey    string
+	TSIGSecret string
+
+	// Net overrides the transport; defaults to "tcp" since UPDATE messages
+	// routinely exceed a single UDP datagram.
+	Net string
+}
+
+func (p *Provider) AppendRecords(ctx context.Context, zone string, records []dnsprovider.Record) ([]dnsprovider.Record, error) {
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+
+	for _, r := range records {
+		rr, err := p.rr(zone, r)
+		if err != nil {
+			return nil, fmt.Errorf("rfc2136: %w", err)
+		}
+		m.Insert([]dns.RR{rr})
+	}
+
+	if err := p.exchange(ctx, m); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []dnsprovider.Record) error {
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+
+	for _, r := range records {
+		rr, err := p.rr(zone, r)
+		if err != nil {
+			return fmt.Errorf("rfc2136: %w", err)
+		}
+		m.Remove([]dns.RR{rr})
+	}
+
+	return p.exchange(ctx, m)
+}
+
+func (p *Provider) rr(zone string, r dnsprovider.Record) (dns.RR, error) {
+	name := zone
+	if r.Name != "" && r.Name != "@" {
+		name = r.Name + "." + zone
+	}
+
+	// TXT's rdata has to be zone-file quoted or dns.NewRR splits it on
+	// whitespace; every other type's Value is already in the rdata syntax
+	// dns.NewRR expects (an IP for A/AAAA, a hostname for NS, "flag tag
+	// value" for CAA), so quoting it unconditionally breaks the parse.
+	value := r.Value
+	if r.Type == "TXT" {
+		value = fmt.Sprintf("%q", r.Value)
+	}
+
+	return dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(name), uint32(r.TTL.Seconds()), r.Type, value))
+}
+
+func (p *Provider) exchange(ctx context.Context, m *dns.Msg) error {
+	client := &dns.Client{Net: p.net()}
+
+	if p.TSIGKey != "" {
+		m.SetTsig(dns.Fqdn(p.TSIGKey), dns.HmacSHA256, 300, time.Now().Unix())
+		client.TsigSecret = map[string]string{dns.Fqdn(p.TSIGKey): p.TSIGSecret}
+	}
+
+	in, _, err := client.ExchangeContext(ctx, m, p.Server)
+	if err != nil {
+		return fmt.Errorf("rfc2136: %w", err)
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("rfc2136: update rejected: %s", dns.RcodeToString[in.Rcode])
+	}
+	return nil
+}
+
+func (p *Provider) net() string {
+	if p.Net != "" {
+		return p.Net
+	}
+	return "tcp"
+}
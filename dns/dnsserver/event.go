@@ -0,0 +1,22 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnsserver
+
+// Event describes an occurrence a caller might want to react to (metrics,
+// alerting, cluster fan-out).
+type Event struct {
+	Type   string
+	Domain string
+	Data   map[string]interface{}
+}
+
+// ZoneTransferred is the Event.Type fired whenever a zone is transferred
+// (AXFR/IXFR) to a remote name server.
+const ZoneTransferred = "ZoneTransferred"
+
+// Notifier is called synchronously for each Event.
+type Notifier interface {
+	Notify(event Event)
+}
@@ -31,6 +31,9 @@ type Config struct {
 	ErrorLog Logger // Defaults to log package's standard logger
 	DebugLog Logger // Defaults to nothingness
 
+	// Events, if set, is notified of ZoneTransferred (and future) events.
+	Events Notifier
+
 	// If provided, this channel will be closed once all listeners are ready.
 	Ready chan struct{}
 
@@ -58,7 +61,7 @@ func Serve(ctx context.Context, resolver Resolver, serverConfig *Config) (err er
 	}
 
 	handler := dns.HandlerFunc(func(w dns.ResponseWriter, m *dns.Msg) {
-		handle(w, m, resolver, &config.SOA, config.ErrorLog, config.DebugLog)
+		handle(w, m, resolver, &config.SOA, config.ErrorLog, config.DebugLog, config.Events)
 	})
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -112,7 +115,7 @@ func Serve(ctx context.Context, resolver Resolver, serverConfig *Config) (err er
 	return
 }
 
-func handle(w dns.ResponseWriter, questMsg *dns.Msg, resolver Resolver, soa *SOA, errorLog, debugLog Logger) {
+func handle(w dns.ResponseWriter, questMsg *dns.Msg, resolver Resolver, soa *SOA, errorLog, debugLog Logger, events Notifier) {
 	defer func() {
 		if x := recover(); x != nil {
 			errorLog.Printf("panic: %v", x)
@@ -158,7 +161,7 @@ func handle(w dns.ResponseWriter, questMsg *dns.Msg, resolver Resolver, soa *SOA
 
 	var (
 		serial  uint32
-		nodes   []naming.Node
+		nodes   []naming.NodeRecords
 		hasApex bool
 	)
 
@@ -166,6 +169,14 @@ func handle(w dns.ResponseWriter, questMsg *dns.Msg, resolver Resolver, soa *SOA
 		if soa.authority() {
 			nodes, serial = resolver.TransferZone(strings.ToLower(q.Name))
 			hasApex = true
+
+			if nodes != nil && events != nil {
+				events.Notify(Event{
+					Type:   ZoneTransferred,
+					Domain: q.Name,
+					Data:   map[string]interface{}{"remote": w.RemoteAddr().String(), "serial": serial},
+				})
+			}
 		}
 	} else {
 		var (
@@ -175,7 +186,7 @@ func handle(w dns.ResponseWriter, questMsg *dns.Msg, resolver Resolver, soa *SOA
 
 		node, rs, serial = resolver.ResolveRecords(strings.ToLower(q.Name), naming.RecordType(q.Qtype))
 		if node != "" {
-			nodes = []naming.Node{{Name: node, Records: rs}}
+			nodes = []naming.NodeRecords{{Name: node, Records: rs}}
 			hasApex = (node == naming.Apex)
 		}
 	}
@@ -275,6 +286,22 @@ func handle(w dns.ResponseWriter, questMsg *dns.Msg, resolver Resolver, soa *SOA
 						})
 					}
 
+				case naming.TypeCAA:
+					if replyType(&q, dns.TypeCAA) {
+						r := x.(naming.RecordCAA)
+						replyMsg.Answer = append(replyMsg.Answer, &dns.CAA{
+							Hdr: dns.RR_Header{
+								Name:   name,
+								Rrtype: dns.TypeCAA,
+								Class:  dns.ClassINET,
+								Ttl:    r.TTL,
+							},
+							Flag:  r.Flag,
+							Tag:   r.Tag,
+							Value: r.Value,
+						})
+					}
+
 				default:
 					if debugLog != nil {
 						debugLog.Printf("dnsserver: node %q has unknown record type: %v", name, t)
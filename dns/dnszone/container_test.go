@@ -0,0 +1,123 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dnszone
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tsavola/acmedns/dns"
+)
+
+// TestContainerOverlappingTXTValues drives two overlapping ACME
+// authorizations (e.g. a zone's apex and wildcard names, as acmedns.VerifyAll
+// presents them) through a single Container: both challenge values must be
+// visible at _acme-challenge together, and removing one must leave the
+// other in place.
+func TestContainerOverlappingTXTValues(t *testing.T) {
+	c := Init(&Zone{Domain: "example.org."})
+	ctx := context.Background()
+
+	if err := c.AppendTXTValue(ctx, "example.org.", "_acme-challenge", "apex-value", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AppendTXTValue(ctx, "example.org.", "_acme-challenge", "wildcard-value", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	txt := findTXT(t, c, "apex and wildcard both pending")
+	if !containsValue(txt.Values, "apex-value") || !containsValue(txt.Values, "wildcard-value") {
+		t.Fatalf("expected both challenge values present, got %v", txt.Values)
+	}
+
+	if err := c.RemoveTXTValue("example.org.", "_acme-challenge", "apex-value"); err != nil {
+		t.Fatal(err)
+	}
+
+	txt = findTXT(t, c, "only wildcard still pending")
+	if containsValue(txt.Values, "apex-value") {
+		t.Fatalf("apex-value should have been removed, got %v", txt.Values)
+	}
+	if !containsValue(txt.Values, "wildcard-value") {
+		t.Fatalf("wildcard-value should have survived, got %v", txt.Values)
+	}
+
+	if err := c.RemoveTXTValue("example.org.", "_acme-challenge", "wildcard-value"); err != nil {
+		t.Fatal(err)
+	}
+
+	if resolveTXT(c) != nil {
+		t.Fatal("expected _acme-challenge record to be gone entirely")
+	}
+}
+
+func findTXT(t *testing.T, c *Container, when string) dns.RecordTXT {
+	t.Helper()
+
+	r := resolveTXT(c)
+	if r == nil {
+		t.Fatalf("no _acme-challenge TXT record found (%s)", when)
+	}
+	return *r
+}
+
+func resolveTXT(c *Container) *dns.RecordTXT {
+	nodes, _ := c.TransferZone("example.org.")
+	for _, n := range nodes {
+		if n.Name != "_acme-challenge" {
+			continue
+		}
+		for _, r := range n.Records {
+			if txt, ok := r.(dns.RecordTXT); ok {
+				return &txt
+			}
+		}
+	}
+	return nil
+}
+
+func containsValue(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// TestContainerTransferCAA checks that a CAA RRset set via ModifyRecord
+// survives a full zone transfer round-trip through TransferZone.
+func TestContainerTransferCAA(t *testing.T) {
+	c := Init(&Zone{Domain: "example.org."})
+	ctx := context.Background()
+
+	want := dns.RecordCAA{Flag: 0, Tag: "issue", Value: "letsencrypt.org", TTL: 3600}
+
+	if err := c.ModifyRecord(ctx, "example.org.", dns.Apex, want); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, _ := c.TransferZone("example.org.")
+
+	var got *dns.RecordCAA
+	for _, n := range nodes {
+		if n.Name != dns.Apex {
+			continue
+		}
+		for _, r := range n.Records {
+			if caa, ok := r.(dns.RecordCAA); ok {
+				caa := caa
+				got = &caa
+			}
+		}
+	}
+
+	if got == nil {
+		t.Fatal("no CAA record found after zone transfer")
+	}
+	if *got != want {
+		t.Fatalf("CAA record changed across transfer: got %+v, want %+v", *got, want)
+	}
+}
@@ -43,7 +43,7 @@ func InitWithSerial(serial uint32, zones ...*Zone) *Container {
 	}
 }
 
-func (c *Container) ResolveResource(name string) (result dns.Node, serial uint32) {
+func (c *Container) ResolveResource(name string) (result dns.NodeRecords, serial uint32) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
@@ -85,7 +85,7 @@ func (c *Container) ResolveZone(ctx context.Context, hostname string) (domain st
 	return
 }
 
-func (c *Container) TransferZone(name string) (results []dns.Node, serial uint32) {
+func (c *Container) TransferZone(name string) (results []dns.NodeRecords, serial uint32) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
@@ -100,11 +100,71 @@ func (c *Container) TransferZone(name string) (results []dns.Node, serial uint32
 	return
 }
 
-// ModifyTXTRecord implements the focused acmedns.DNS interface.
+// ModifyTXTRecord replaces the whole TXT RRset at node.  It's kept as a
+// general-purpose zone management primitive, but acmedns.DNS and
+// autocert.DNS no longer require it: a second concurrent ACME authorization
+// (e.g. the apex and wildcard SANs of one certificate) would clobber the
+// first's challenge value, since both live at the same _acme-challenge
+// node.  Use AppendTXTValue/RemoveTXTValue for that instead.
 func (c *Container) ModifyTXTRecord(ctx context.Context, zone, node string, values []string, ttl uint32) error {
 	return c.ModifyRecord(ctx, zone, node, dns.RecordTXT{Values: values, TTL: ttl})
 }
 
+// AppendTXTValue implements acmedns.DNS and autocert.DNS.  It adds value to
+// the TXT RRset at node without disturbing any other values already there,
+// so that multiple concurrently-pending ACME authorizations (e.g. for a
+// combined wildcard + apex certificate) can each publish their own
+// challenge value at the same node.
+func (c *Container) AppendTXTValue(ctx context.Context, zoneName, node, value string, ttl uint32) error {
+	c.mutex.Lock()
+
+	var targetZone *Zone
+
+	for _, z := range c.zones {
+		if z.Domain == zoneName {
+			targetZone = z
+			break
+		}
+	}
+
+	if targetZone == nil {
+		c.mutex.Unlock()
+		return newZoneError(zoneName)
+	}
+
+	targetZone.appendTXTValue(node, value, ttl)
+	ready := c.scheduleChange(targetZone)
+
+	c.mutex.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+
+	case <-ready:
+		return nil
+	}
+}
+
+// RemoveTXTValue implements acmedns.DNS and autocert.DNS.  It removes a
+// single value from the TXT RRset at node, leaving any other values (e.g.
+// a sibling authorization's still-pending challenge) in place.  Unlike
+// AppendTXTValue, it doesn't wait for the removal to be visible.
+func (c *Container) RemoveTXTValue(zoneName, node, value string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, z := range c.zones {
+		if z.Domain == zoneName {
+			z.removeTXTValue(node, value)
+			c.scheduleChange(z)
+			return nil
+		}
+	}
+
+	return newZoneError(zoneName)
+}
+
 func (c *Container) ModifyRecord(ctx context.Context, zoneName, node string, r dns.Record) error {
 	c.mutex.Lock()
 
@@ -204,11 +264,11 @@ func (z *Zone) resolveNode(node string) (rs dns.Records) {
 	return
 }
 
-func (z *Zone) transfer() (results []dns.Node) {
-	results = make([]dns.Node, 0, len(z.Nodes))
+func (z *Zone) transfer() (results []dns.NodeRecords) {
+	results = make([]dns.NodeRecords, 0, len(z.Nodes))
 
 	if rs := z.Nodes[dns.Apex]; rs != nil {
-		results = append(results, dns.Node{
+		results = append(results, dns.NodeRecords{
 			Name:    dns.Apex,
 			Records: rs.DeepCopy(),
 		})
@@ -216,7 +276,7 @@ func (z *Zone) transfer() (results []dns.Node) {
 
 	for name, rs := range z.Nodes {
 		if name != dns.Apex && name != dns.Wildcard {
-			results = append(results, dns.Node{
+			results = append(results, dns.NodeRecords{
 				Name:    name,
 				Records: rs.DeepCopy(),
 			})
@@ -224,7 +284,7 @@ func (z *Zone) transfer() (results []dns.Node) {
 	}
 
 	if rs := z.Nodes[dns.Wildcard]; rs != nil {
-		results = append(results, dns.Node{
+		results = append(results, dns.NodeRecords{
 			Name:    dns.Wildcard,
 			Records: rs.DeepCopy(),
 		})
@@ -265,6 +325,64 @@ func (z *Zone) modifyRecord(node string, r dns.Record) {
 	}
 }
 
+// appendTXTValue adds value to the TXT record at node, creating it with ttl
+// if it doesn't exist yet.  A value already present is left alone instead of
+// being duplicated.
+func (z *Zone) appendTXTValue(node, value string, ttl uint32) {
+	if z.Nodes == nil {
+		z.Nodes = make(map[string]dns.Records)
+	}
+
+	rs := z.Nodes[node]
+	for i, r := range rs {
+		if txt, ok := r.(dns.RecordTXT); ok {
+			for _, v := range txt.Values {
+				if v == value {
+					return
+				}
+			}
+			txt.Values = append(txt.Values, value)
+			txt.TTL = ttl
+			rs[i] = txt
+			return
+		}
+	}
+
+	z.Nodes[node] = append(rs, dns.RecordTXT{Values: []string{value}, TTL: ttl})
+}
+
+// removeTXTValue removes a single value from the TXT record at node,
+// leaving its other values in place.  The record is deleted once its last
+// value is removed.  It's not an error for value to be absent.
+func (z *Zone) removeTXTValue(node, value string) {
+	rs := z.Nodes[node]
+	for i, r := range rs {
+		txt, ok := r.(dns.RecordTXT)
+		if !ok {
+			continue
+		}
+
+		for j, v := range txt.Values {
+			if v != value {
+				continue
+			}
+
+			txt.Values = append(txt.Values[:j], txt.Values[j+1:]...)
+			if len(txt.Values) > 0 {
+				rs[i] = txt
+			} else {
+				rs = append(rs[:i], rs[i+1:]...)
+				if len(rs) > 0 {
+					z.Nodes[node] = rs
+				} else {
+					delete(z.Nodes, node)
+				}
+			}
+			return
+		}
+	}
+}
+
 func deepCopyStrings(values []string) []string {
 	return append([]string(nil), values...)
 }
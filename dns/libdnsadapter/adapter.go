@@ -0,0 +1,208 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package libdnsadapter adapts libdns-style DNS provider implementations
+// (https://github.com/libdns/libdns) to this module's DNS interfaces.  Since
+// the certmagic/libdns ecosystem already has provider packages for
+// Cloudflare, Route53, DigitalOcean, Gandi, OVH, Azure, GCP, and dozens of
+// others, this lets a legodns.Provider or autocert.Manager delegate to any
+// of them without per-provider glue.
+//
+// See the top-level package for general documentation.
+package libdnsadapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libdns/libdns"
+
+	"github.com/go-acme/lego/challenge/dns01"
+
+	"github.com/tsavola/acmedns/legodns"
+)
+
+const (
+	resolver = "acmedns/dns/libdnsadapter"
+)
+
+// Provider is the subset of libdns.Provider that the adapter needs in order
+// to manage TXT records.
+type Provider interface {
+	libdns.RecordAppender
+	libdns.RecordDeleter
+}
+
+// Adapter implements autocert.DNS, legodns.DNS (via Lego), and acmedns.DNS
+// on top of a libdns Provider.
+type Adapter struct {
+	Provider Provider
+
+	// Confirm, if set, is used by ResolveZone to confirm that a zone is
+	// actually served by Provider before it is handed back to the caller:
+	// GetRecords on a zone Provider doesn't manage returns an error for
+	// every libdns provider that matters, so a successful call confirms
+	// Provider actually knows about domain.  It is optional; without it,
+	// ResolveZone trusts FindZoneByFqdn's SOA lookup alone.
+	Confirm libdns.RecordGetter
+}
+
+// New creates an Adapter wrapping provider.
+func New(provider Provider) *Adapter {
+	return &Adapter{Provider: provider}
+}
+
+// ResolveZone checks the existence of a host by finding its enclosing zone
+// via SOA lookup, the same way dns01.FindZoneByFqdn does it for lego's own
+// DNS-01 solvers.
+func (a *Adapter) ResolveZone(ctx context.Context, hostname string) (domain string, err error) {
+	domain, err = dns01.FindZoneByFqdn(hostname)
+	if err != nil {
+		return "", &existenceError{name: hostname, reason: err.Error()}
+	}
+
+	if a.Confirm != nil {
+		if _, err := a.Confirm.GetRecords(ctx, domain); err != nil {
+			return "", &existenceError{name: hostname, reason: "zone not served by provider: " + err.Error()}
+		}
+	}
+
+	return domain, nil
+}
+
+// AppendTXTValue implements acmedns.DNS and autocert.DNS.  A libdns
+// Provider's AppendRecords is additive by nature, so unlike ModifyTXTRecord
+// this doesn't need to delete anything first: two overlapping ACME
+// authorizations (e.g. a zone's apex and wildcard names) can each append
+// their own challenge value at the same node without clobbering the other.
+func (a *Adapter) AppendTXTValue(ctx context.Context, zone, node, value string, ttl uint32) error {
+	name := recordName(node)
+
+	if _, err := a.Provider.AppendRecords(ctx, zone, []libdns.Record{{
+		Type:  "TXT",
+		Name:  name,
+		Value: value,
+		TTL:   time.Duration(ttl) * time.Second,
+	}}); err != nil {
+		return fmt.Errorf("libdnsadapter: append %s TXT value: %w", name, err)
+	}
+
+	return nil
+}
+
+// RemoveTXTValue implements acmedns.DNS and autocert.DNS.  Only the given
+// value is removed; any other values at node are left alone.
+func (a *Adapter) RemoveTXTValue(zone, node, value string) error {
+	_, err := a.Provider.DeleteRecords(context.Background(), zone, []libdns.Record{{
+		Type:  "TXT",
+		Name:  recordName(node),
+		Value: value,
+	}})
+	return err
+}
+
+// ModifyTXTRecord replaces the whole TXT RRset at node.  It's not part of
+// acmedns.DNS/autocert.DNS (see AppendTXTValue/RemoveTXTValue), but Lego's
+// legodns.DNS view still uses replace semantics, since lego only ever
+// solves one challenge at a time per domain.
+func (a *Adapter) ModifyTXTRecord(ctx context.Context, zone, node string, values []string, ttl uint32) error {
+	name := recordName(node)
+
+	if _, err := a.Provider.DeleteRecords(ctx, zone, []libdns.Record{{Type: "TXT", Name: name}}); err != nil {
+		return fmt.Errorf("libdnsadapter: delete existing %s TXT record: %w", name, err)
+	}
+
+	records := make([]libdns.Record, len(values))
+	for i, v := range values {
+		records[i] = libdns.Record{
+			Type:  "TXT",
+			Name:  name,
+			Value: v,
+			TTL:   time.Duration(ttl) * time.Second,
+		}
+	}
+
+	if _, err := a.Provider.AppendRecords(ctx, zone, records); err != nil {
+		return fmt.Errorf("libdnsadapter: append %s TXT record: %w", name, err)
+	}
+
+	return nil
+}
+
+// ForgetTXTRecord removes the whole TXT RRset at node.  Not part of
+// acmedns.DNS/autocert.DNS (see RemoveTXTValue); used by Lego's legodns.DNS
+// view.
+func (a *Adapter) ForgetTXTRecord(zone, node string) error {
+	_, err := a.Provider.DeleteRecords(context.Background(), zone, []libdns.Record{{Type: "TXT", Name: recordName(node)}})
+	return err
+}
+
+// Lego returns a legodns.DNS view of the adapter.  legodns.DNS operates on a
+// fully-qualified name instead of a (zone, node) pair, so it resolves the
+// zone itself on every call.
+func (a *Adapter) Lego() legodns.DNS {
+	return legoDNS{a}
+}
+
+type legoDNS struct {
+	*Adapter
+}
+
+func (d legoDNS) ModifyTXTRecord(ctx context.Context, fqdn string, values []string, ttl int) error {
+	zone, node, err := d.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+	return d.Adapter.ModifyTXTRecord(ctx, zone, node, values, uint32(ttl))
+}
+
+func (d legoDNS) ForgetTXTRecord(fqdn string) error {
+	zone, node, err := d.splitFqdn(fqdn)
+	if err != nil {
+		return err
+	}
+	return d.Adapter.ForgetTXTRecord(zone, node)
+}
+
+func (d legoDNS) splitFqdn(fqdn string) (zone, node string, err error) {
+	zone, err = dns01.FindZoneByFqdn(fqdn)
+	if err != nil {
+		return "", "", fmt.Errorf("libdnsadapter: %w", err)
+	}
+
+	node = fqdn[:len(fqdn)-len(zone)]
+	node = trimDot(node)
+	if node == "" {
+		node = "@"
+	}
+	return zone, node, nil
+}
+
+func recordName(node string) string {
+	if node == "@" {
+		return "@"
+	}
+	return node
+}
+
+func trimDot(s string) string {
+	if len(s) > 0 && s[len(s)-1] == '.' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+type existenceError struct {
+	name   string
+	reason string
+}
+
+func (e *existenceError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", resolver, e.name, e.reason)
+}
+
+func (*existenceError) NotExist() bool {
+	return true
+}
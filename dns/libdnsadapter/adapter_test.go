@@ -0,0 +1,71 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libdnsadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libdns/libdns"
+)
+
+type fakeProvider struct {
+	records []libdns.Record
+}
+
+func (p *fakeProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	p.records = append(p.records, recs...)
+	return recs, nil
+}
+
+func (p *fakeProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	var (
+		deleted []libdns.Record
+		kept    []libdns.Record
+	)
+
+	for _, r := range p.records {
+		match := false
+		for _, d := range recs {
+			if r.Type == d.Type && r.Name == d.Name {
+				match = true
+			}
+		}
+		if match {
+			deleted = append(deleted, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+
+	p.records = kept
+	return deleted, nil
+}
+
+func TestAdapterModifyAndForget(t *testing.T) {
+	p := &fakeProvider{}
+	a := New(p)
+
+	if err := a.ModifyTXTRecord(context.Background(), "example.org.", "_acme-challenge", []string{"one"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.records) != 1 || p.records[0].Value != "one" {
+		t.Fatalf("unexpected records: %+v", p.records)
+	}
+
+	if err := a.ModifyTXTRecord(context.Background(), "example.org.", "_acme-challenge", []string{"two"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.records) != 1 || p.records[0].Value != "two" {
+		t.Fatalf("ModifyTXTRecord should replace the RRset, got: %+v", p.records)
+	}
+
+	if err := a.ForgetTXTRecord("example.org.", "_acme-challenge"); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.records) != 0 {
+		t.Fatalf("expected no records after ForgetTXTRecord, got: %+v", p.records)
+	}
+}
@@ -14,6 +14,7 @@ const (
 	TypeNS              = 2
 	TypeTXT             = 16
 	TypeAAAA            = 28
+	TypeCAA             = 257
 )
 
 type Record interface {
@@ -27,20 +28,33 @@ type RecordNS StringRecord
 type RecordTXT StringsRecord
 type RecordAAAA IPRecord
 
+// RecordCAA restricts which CAs may issue for a name (RFC 6844/8659), e.g.
+// {Tag: "issue", Value: "letsencrypt.org"} or {Tag: "issue", Value:
+// `sectigo.com; accounturi=...`} for CAs that require EAB parameters.
+type RecordCAA struct {
+	Flag  uint8
+	Tag   string
+	Value string
+	TTL   uint32
+}
+
 func (r RecordA) DeepCopy() Record    { return RecordA((*IPRecord)(&r).DeepCopy()) }
 func (r RecordNS) DeepCopy() Record   { return RecordNS((*StringRecord)(&r).DeepCopy()) }
 func (r RecordTXT) DeepCopy() Record  { return RecordTXT((*StringsRecord)(&r).DeepCopy()) }
 func (r RecordAAAA) DeepCopy() Record { return RecordAAAA((*IPRecord)(&r).DeepCopy()) }
+func (r RecordCAA) DeepCopy() Record  { return r }
 
 func (r RecordA) Empty() bool    { return len(r.Value) == 0 }
 func (r RecordNS) Empty() bool   { return r.Value == "" }
 func (r RecordTXT) Empty() bool  { return len(r.Values) == 0 }
 func (r RecordAAAA) Empty() bool { return len(r.Value) == 0 }
+func (r RecordCAA) Empty() bool  { return r.Tag == "" }
 
 func (RecordA) Type() RecordType    { return TypeA }
 func (RecordNS) Type() RecordType   { return TypeNS }
 func (RecordTXT) Type() RecordType  { return TypeTXT }
 func (RecordAAAA) Type() RecordType { return TypeAAAA }
+func (RecordCAA) Type() RecordType  { return TypeCAA }
 
 // Records contains Record*-type items (values, not pointers).  There must not
 // be more than one item of a given type.
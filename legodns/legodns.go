@@ -0,0 +1,71 @@
+// Copyright (c) 2018 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package legodns adapts this module's DNS interfaces to
+// github.com/go-acme/lego's challenge.Provider, so a DNS backend plugged
+// into acmedns/autocert can also drive lego's own ACME client.
+//
+// See the top-level package for general documentation.
+package legodns
+
+import (
+	"context"
+
+	"github.com/go-acme/lego/challenge/dns01"
+
+	"github.com/tsavola/acmedns/dns/dnsprop"
+)
+
+const ttl = 1 // second
+
+// DNS can create, update and remove TXT records.
+type DNS interface {
+	// ModifyTXTRecord creates, updates, or removes a TXT record.  It blocks
+	// until the modification is complete or the context is done.
+	ModifyTXTRecord(ctx context.Context, fqdn string, values []string, ttl int) error
+
+	// ForgetTXTRecord removes a TXT record immediately or at some point in the
+	// future.  It doesn't have to wait for the modification to be complete.
+	// It's ok if the name doesn't exist.
+	ForgetTXTRecord(fqdn string) error
+}
+
+// Provider can solve ACME dns-01 challenges.
+type Provider struct {
+	dns DNS
+
+	// Propagation, if set, makes Present block until the challenge record
+	// is visible on the zone's authoritative name servers instead of
+	// relying on the DNS backend's own TTL/coalescing delay.
+	Propagation *dnsprop.Config
+}
+
+func NewProvider(dns DNS) *Provider {
+	return &Provider{dns: dns}
+}
+
+func (p *Provider) Present(domain, token, keyAuth string) error {
+	fqdn, value := dns01.GetRecord(domain, keyAuth)
+
+	if err := p.dns.ModifyTXTRecord(context.Background(), fqdn, []string{value}, ttl); err != nil {
+		return err
+	}
+
+	if p.Propagation != nil {
+		zone, err := dns01.FindZoneByFqdn(fqdn)
+		if err != nil {
+			return err
+		}
+		if err := p.Propagation.Check(context.Background(), zone, fqdn, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Provider) CleanUp(domain, token, keyAuth string) error {
+	fqdn, _ := dns01.GetRecord(domain, keyAuth)
+	return p.dns.ForgetTXTRecord(fqdn)
+}